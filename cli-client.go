@@ -1,19 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"golang.org/x/net/context"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	pb "github.com/otm/limes/proto"
 	"google.golang.org/grpc"
@@ -25,9 +30,16 @@ type awsEnv struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	Expiration      string
 	Region          string
 }
 
+type containerEnv struct {
+	FullURI            string
+	AuthorizationToken string
+	Region             string
+}
+
 type cliClient struct {
 	conn *grpc.ClientConn
 	srv  pb.InstanceMetaServiceClient
@@ -58,34 +70,29 @@ func StartService(configFile, address, profileName, MFA string, port int, fake b
 	log := &ConsoleLogger{}
 	config := Config{}
 
-	// TODO: Move to function and use a default configuration file
 	if configFile != "" {
-		// Parse in options from the given config file.
 		log.Debug("Loading configuration: %s\n", configFile)
-		configContents, configErr := ioutil.ReadFile(configFile)
-		if configErr != nil {
-			log.Fatalf("Error reading config: %s\n", configErr.Error())
+		var err error
+		config, err = readConfig(configFile)
+		if err != nil {
+			log.Fatalf("Error reading config: %s\n", err)
 		}
 
-		configParseErr := yaml.Unmarshal(configContents, &config)
-		if configParseErr != nil {
-			log.Fatalf("Error in parsing config file: %s\n", configParseErr.Error())
-		}
-
-		if len(config.Profiles) == 0 {
-			log.Info("No profiles found, falling back to old config format.\n")
-			configParseErr := yaml.Unmarshal(configContents, &config.Profiles)
-			if configParseErr != nil {
-				log.Fatalf("Error in parsing config file: %s\n", configParseErr.Error())
-			}
-			if len(config.Profiles) > 0 {
-				log.Warning("WARNING: old deprecated config format is used.\n")
-			}
+		if config.legacyFormat {
+			log.Warning("WARNING: old deprecated config format is used.\n")
 		}
 	} else {
 		log.Debug("No configuration file given\n")
 	}
 
+	if err := config.check(); err != nil {
+		log.Fatalf("Error in config file: %s\n", err)
+	}
+
+	if config.Profiles.usesKeystore() && !fake {
+		unlockKeystoreAtStart(log)
+	}
+
 	defer func() {
 		log.Debug("Removing socket: %v\n", address)
 		os.Remove(address)
@@ -115,22 +122,59 @@ func StartService(configFile, address, profileName, MFA string, port int, fake b
 		credsManager = NewCredentialsExpirationManager(profileName, config, MFA)
 	}
 
+	home, err := homeDir()
+	if err != nil {
+		log.Fatalf("Unable to fetch user information: %s\n", err)
+	}
+
+	identity, err := loadInstanceIdentity(filepath.Join(home, identityFilePath))
+	if err != nil {
+		log.Fatalf("Failed to load instance identity: %s\n", err)
+	}
+
 	log.Info("Starting web service: %v:%v\n", "169.254.169.254", port)
-	mds, metadataError := NewMetadataService(listener, credsManager)
+	mds, metadataError := NewMetadataService(listener, credsManager, config, identity)
 	if metadataError != nil {
 		log.Fatalf("Failed to start metadata service: %s\n", metadataError.Error())
 	}
 	mds.Start()
 
+	var containers ContainerService
+	if config.ContainerPort != 0 {
+		containerListener, err := net.ListenTCP("tcp", &net.TCPAddr{
+			IP:   net.ParseIP(containerCredentialsHost),
+			Port: config.ContainerPort,
+		})
+		if err != nil {
+			log.Fatalf("Failed to bind to socket: %s\n", err)
+		}
+
+		containers, err = NewContainerService(containerListener, credsManager, config)
+		if err != nil {
+			log.Fatalf("Failed to start container credentials service: %s\n", err.Error())
+		}
+		log.Info("Starting container credentials service: %v\n", containers.URI())
+		containers.Start()
+	}
+
 	stop := make(chan struct{})
-	agentServer := NewCliHandler(address, credsManager, stop, config)
+	agentServer := NewCliHandler(address, configFile, credsManager, stop, config, identity, containers)
 	err = agentServer.Start()
 	if err != nil {
 		log.Fatalf("Failed to start agentServer: %s\n", err.Error())
 	}
 
+	if config.IdleLock > 0 {
+		go lockWhenIdle(time.Duration(config.IdleLock)*time.Minute, func() {
+			log.Info("Idle for %v minutes: locking\n", config.IdleLock)
+			if err := agentServer.lock(); err != nil {
+				log.Warning("Unable to lock: %v\n", err)
+			}
+		})
+	}
+
 	// Wait for a graceful shutdown signal
-	terminate := make(chan os.Signal)
+	terminate := make(chan os.Signal, 1)
 	signal.Notify(terminate, syscall.SIGINT, syscall.SIGTERM)
 
 	log.Info("Service: online\n")
@@ -146,6 +190,30 @@ func StartService(configFile, address, profileName, MFA string, port int, fake b
 	}
 }
 
+/*
+unlockKeystoreAtStart asks for the keystore passphrase when the service is
+started from a terminal. Otherwise the keystore is unlocked on first use.
+*/
+func unlockKeystoreAtStart(log Logger) {
+	path, err := keystorePath()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	passphrase, err := askPassphrase("Keystore passphrase (empty to unlock later): ")
+	if err != nil || passphrase == "" {
+		log.Info("Keystore is locked\n")
+		return
+	}
+
+	if err := unlockKeystore(passphrase); err != nil {
+		log.Fatalf("Unable to unlock keystore: %s\n", err)
+	}
+}
+
 func (c *cliClient) close() error {
 	return c.conn.Close()
 }
@@ -206,6 +274,15 @@ func (c *cliClient) printStatus(args *Status) error {
 		fmt.Fprintf(out, "Status:          %v\n", "ok")
 	}
 	fmt.Fprintf(out, "Profile:            %v\n", r.Role)
+	if len(r.Previous) > 0 {
+		fmt.Fprintf(out, "Previous:        %v\n", strings.Join(r.Previous, ", "))
+	}
+	if r.RevertAt != "" {
+		fmt.Fprintf(out, "Reverts:         %v\n", describeRevert(r))
+	}
+	if requests, err := c.pendingMFA(); err == nil && len(requests) > 0 {
+		fmt.Fprintf(out, "MFA:             %v pending, run 'limes mfa'\n", len(requests))
+	}
 
 	if args.Verbose == false {
 		return err
@@ -225,11 +302,20 @@ func (c *cliClient) status() (*pb.StatusReply, error) {
 	return c.srv.Status(context.Background(), &pb.Void{})
 }
 
-func (c *cliClient) assumeRole(role string, MFA string) error {
-	r, err := c.srv.AssumeRole(context.Background(), &pb.AssumeRoleRequest{Name: role, Mfa: MFA})
+// assumeRole assumes role, the previous profile is assumed again after d if it is not zero
+func (c *cliClient) assumeRole(role string, MFA string, d time.Duration) error {
+	req := &pb.AssumeRoleRequest{Name: role, Mfa: MFA, ForSeconds: int64(d / time.Second)}
+	r, err := c.srv.AssumeRole(context.Background(), req)
 	if err != nil {
 		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errMFANeeded.Error() {
-			return c.assumeRole(role, askMFA())
+			return c.assumeRole(role, askMFA(), d)
+		}
+		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errKeystoreLocked.Error() && c.unlock() == nil {
+			return c.assumeRole(role, MFA, d)
+		}
+		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errNoPreviousProfile.Error() {
+			fmt.Fprint(errout, lookupCorrection(err))
+			return err
 		}
 
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -237,15 +323,34 @@ func (c *cliClient) assumeRole(role string, MFA string) error {
 	}
 
 	fmt.Fprintf(out, "Assumed: %v\n", r.Role)
+	if r.RevertAt != "" {
+		fmt.Fprintf(out, "Reverts %v\n", describeRevert(r))
+	}
 	return nil
 }
 
+// describeRevert tells when, and to which profile, the active profile of r is reverted
+func describeRevert(r *pb.StatusReply) string {
+	when := r.RevertAt
+	if t, err := time.Parse(time.RFC3339, r.RevertAt); err == nil {
+		when = fmt.Sprintf("in %v", time.Until(t).Round(time.Second))
+	}
+
+	if len(r.Previous) == 0 {
+		return fmt.Sprintf("%v, the service is then locked", when)
+	}
+	return fmt.Sprintf("to %v %v", r.Previous[0], when)
+}
+
 func (c *cliClient) retreiveRole(role, MFA string) (*credentials.Credentials, error) {
 	r, err := c.srv.RetrieveRole(context.Background(), &pb.AssumeRoleRequest{Name: role, Mfa: MFA})
 	if err != nil {
 		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errMFANeeded.Error() {
 			return c.retreiveRole(role, askMFA())
 		}
+		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errKeystoreLocked.Error() && c.unlock() == nil {
+			return c.retreiveRole(role, MFA)
+		}
 
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return nil, err
@@ -260,28 +365,85 @@ func (c *cliClient) retreiveRole(role, MFA string) (*credentials.Credentials, er
 	return creds, nil
 }
 
-func (c *cliClient) retreiveAWSEnv(role, MFA string) (awsEnv, error) {
-	r, err := c.srv.RetrieveRole(context.Background(), &pb.AssumeRoleRequest{Name: role, Mfa: MFA})
+func (c *cliClient) retreiveAWSEnv(role, MFA string, policy *pb.SessionPolicy) (awsEnv, error) {
+	r, err := c.srv.RetrieveRole(context.Background(), &pb.AssumeRoleRequest{Name: role, Mfa: MFA, Policy: policy})
 	if err != nil {
 		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errMFANeeded.Error() {
-			return c.retreiveAWSEnv(role, askMFA())
+			return c.retreiveAWSEnv(role, askMFA(), policy)
+		}
+		if grpc.Code(err) == codes.FailedPrecondition && grpc.ErrorDesc(err) == errKeystoreLocked.Error() && c.unlock() == nil {
+			return c.retreiveAWSEnv(role, MFA, policy)
 		}
 
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return awsEnv{}, err
 	}
 
-	fmt.Println("client got region: ", r.Region)
 	creds := awsEnv{
 		AccessKeyID:     r.AccessKeyId,
 		SecretAccessKey: r.SecretAccessKey,
 		SessionToken:    r.SessionToken,
+		Expiration:      r.Expiration,
 		Region:          r.Region,
 	}
 
 	return creds, nil
 }
 
+/*
+sessionPolicyFlags returns the session policy given with the --policy,
+--policy-arn and --read-only flags, or nil if none of them are used. The
+policy document is read from the file policyFile.
+*/
+func sessionPolicyFlags(policyFile string, policyARNs []string, readOnly bool) (*pb.SessionPolicy, error) {
+	if policyFile == "" && len(policyARNs) == 0 && !readOnly {
+		return nil, nil
+	}
+
+	policy := &pb.SessionPolicy{
+		PolicyArns: policyARNs,
+		ReadOnly:   readOnly,
+	}
+
+	if policyFile != "" {
+		data, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// the size of the policy is limited, so do not send the whitespace
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, data); err != nil {
+			return nil, fmt.Errorf("%v: %v", policyFile, err)
+		}
+		policy.Policy = buf.String()
+	}
+
+	return policy, nil
+}
+
+func (c *cliClient) retreiveContainerEnv(role string) (containerEnv, error) {
+	r, err := c.srv.Status(context.Background(), &pb.Void{})
+	if err != nil {
+		return containerEnv{}, err
+	}
+
+	if role != "" && role != r.Role {
+		return containerEnv{}, fmt.Errorf("container credentials are only served for the assumed profile: %v", r.Role)
+	}
+
+	cr, err := c.srv.ContainerCredentials(context.Background(), &pb.Void{})
+	if err != nil {
+		return containerEnv{}, err
+	}
+
+	return containerEnv{
+		FullURI:            cr.FullURI,
+		AuthorizationToken: cr.AuthorizationToken,
+		Region:             r.Region,
+	}, nil
+}
+
 // Config(ctx context.Context, in *Void, opts ...grpc.CallOption) (*ConfigReply, error)
 func (c *cliClient) listRoles() ([]string, error) {
 	r, err := c.srv.Config(context.Background(), &pb.Void{})
@@ -299,12 +461,189 @@ func (c *cliClient) listRoles() ([]string, error) {
 	return roles, nil
 }
 
-// ask the user for an MFA token
+func (c *cliClient) sessions() ([]*pb.Session, error) {
+	r, err := c.srv.Sessions(context.Background(), &pb.Void{})
+	if err != nil {
+		showCorrectionAndExit(err)
+		return nil, err
+	}
+
+	return r.Sessions, nil
+}
+
+// printSessions prints the sessions of the service with their remaining lifetime
+func printSessions(sessions []*pb.Session) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "PROFILE\tKIND\tEXPIRES\tREMAINING\n")
+	for _, s := range sessions {
+		remaining := "n/a"
+		if expiration, err := time.Parse(time.RFC3339, s.Expiration); err == nil {
+			remaining = "expired"
+			if left := time.Until(expiration); left > 0 {
+				remaining = left.Truncate(time.Second).String()
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.Name, s.Kind, s.Expiration, remaining)
+	}
+	w.Flush()
+}
+
+func (c *cliClient) profiles() (map[string]*pb.Profile, error) {
+	r, err := c.srv.Config(context.Background(), &pb.Void{})
+	if err != nil {
+		showCorrectionAndExit(err)
+		return nil, err
+	}
+
+	return r.Profiles, nil
+}
+
+func (c *cliClient) login(profile string) error {
+	stream, err := c.srv.Login(context.Background(), &pb.LoginRequest{Name: profile})
+	if err != nil {
+		return err
+	}
+
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			fmt.Fprintf(out, "Logged in: %v\n", profile)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		uri := r.VerificationURIComplete
+		if uri == "" {
+			uri = r.VerificationURI
+		}
+		fmt.Fprintf(out, "Open the following URL in a browser to log in:\n\n    %v\n\n", uri)
+		fmt.Fprintf(out, "Verify that the code in the browser is: %v\n", r.UserCode)
+	}
+}
+
+// pendingMFA returns the MFA tokens the service is waiting for
+func (c *cliClient) pendingMFA() ([]*pb.MFARequest, error) {
+	r, err := c.srv.PendingMFA(context.Background(), &pb.Void{})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Requests, nil
+}
+
+// answerMFA asks the user for the MFA token of req, and passes it to the service
+func (c *cliClient) answerMFA(req *pb.MFARequest) error {
+	fmt.Fprintf(out, "MFA needed to renew the credentials of %v (%v)\n", req.Profile, req.Serial)
+
+	_, err := c.srv.AnswerMFA(context.Background(), &pb.AnswerMFARequest{Id: req.Id, Mfa: askMFA()})
+	if err != nil {
+		fmt.Fprint(errout, lookupCorrection(err))
+		return err
+	}
+
+	fmt.Fprintf(out, "Renewed: %v\n", req.Profile)
+	return nil
+}
+
+// lock makes the service forget all credentials
+func (c *cliClient) lock() error {
+	_, err := c.srv.Lock(context.Background(), &pb.Void{})
+	if err != nil && !isServiceDown(err) {
+		fmt.Fprint(errout, lookupCorrection(err))
+		return err
+	}
+
+	if err := removeSessionCache(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Locked\n")
+	return nil
+}
+
+// logout makes the service forget all credentials, the active profile and the SSO tokens
+func (c *cliClient) logout() error {
+	_, err := c.srv.Logout(context.Background(), &pb.Void{})
+	if err != nil && !isServiceDown(err) {
+		fmt.Fprint(errout, lookupCorrection(err))
+		return err
+	}
+
+	if err := removeSessionCache(); err != nil {
+		return err
+	}
+
+	if err := removeSSOTokens(); err != nil {
+		fmt.Fprintf(errout, "unable to remove the SSO tokens: %v\n", err)
+		return err
+	}
+
+	fmt.Fprintf(out, "Logged out\n")
+	return nil
+}
+
+// removeSessionCache removes the session cache, which is removed by the
+// service as well, in case the service is not running
+func removeSessionCache() error {
+	cache, err := newSessionCache()
+	if err == nil {
+		err = cache.remove()
+	}
+	if err != nil {
+		fmt.Fprintf(errout, "unable to remove the session cache: %v\n", err)
+	}
+	return err
+}
+
+func (c *cliClient) unlock() error {
+	passphrase, err := askPassphrase("Keystore passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	_, err = c.srv.Unlock(context.Background(), &pb.UnlockRequest{Passphrase: passphrase})
+	if err != nil {
+		fmt.Fprint(errout, lookupCorrection(err))
+	}
+	return err
+}
+
+// reloadKeystore unlocks the keystore with passphrase, errors are ignored as the service might not run
+func (c *cliClient) reloadKeystore(passphrase string) {
+	c.srv.Unlock(context.Background(), &pb.UnlockRequest{Passphrase: passphrase})
+}
+
+// reloadConfig makes the service read its configuration file again
+func (c *cliClient) reloadConfig() error {
+	_, err := c.srv.ReloadConfig(context.Background(), &pb.Void{})
+	return err
+}
+
+func (c *cliClient) certificate() (string, error) {
+	r, err := c.srv.Certificate(context.Background(), &pb.Void{})
+	if err != nil {
+		showCorrectionAndExit(err)
+		return "", err
+	}
+
+	return r.Certificate, nil
+}
+
+// ask the user for an MFA token, on the terminal if there is one so that the
+// prompt does not end up in output that is captured, e.g. by credential_process
 func askMFA() string {
 	var MFA string
 
-	fmt.Printf("Enter MFA: ")
-	_, err := fmt.Scanf("%s", &MFA)
+	in, prompt := io.Reader(os.Stdin), io.Writer(out)
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		in, prompt = tty, tty
+	}
+
+	fmt.Fprintf(prompt, "Enter MFA: ")
+	_, err := fmt.Fscanln(in, &MFA)
 	if err != nil {
 		log.Fatalf("err: %v\n", err)
 	}
@@ -312,8 +651,63 @@ func askMFA() string {
 	return MFA
 }
 
+// askPassphrase asks the user for a passphrase, without echoing it
+func askPassphrase(prompt string) (string, error) {
+	return askLine(prompt, true)
+}
+
+/*
+askLine asks the user for a line of input on the terminal. If secret is set
+the input is not echoed. If there is no terminal the line is read from stdin.
+*/
+func askLine(prompt string, secret bool) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return readLine(os.Stdin)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	if secret {
+		stty := func(arg string) error {
+			cmd := exec.Command("stty", arg)
+			cmd.Stdin = tty
+			return cmd.Run()
+		}
+		if stty("-echo") == nil {
+			defer fmt.Fprintln(tty)
+			defer stty("echo")
+		}
+	}
+
+	return readLine(tty)
+}
+
+// readLine reads a line from r, without buffering beyond the line
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
 func showCorrectionAndExit(err error) {
-	fmt.Fprintf(errout, lookupCorrection(err))
+	fmt.Fprint(errout, lookupCorrection(err))
 	os.Exit(1)
 }
 
@@ -322,15 +716,43 @@ func lookupCorrection(err error) string {
 	case codes.FailedPrecondition:
 		switch grpc.ErrorDesc(err) {
 		case errMFANeeded.Error():
-			return fmt.Sprintf("%v: run 'limes assume <profile>'\n", grpc.ErrorDesc(err))
+			return fmt.Sprintf("%v: run 'limes mfa' or 'limes assume <profile>'\n", grpc.ErrorDesc(err))
+		case errNoMFARequest.Error():
+			return fmt.Sprintf("%v: run 'limes mfa --list'\n", grpc.ErrorDesc(err))
+		case errMFARequestDropped.Error():
+			return fmt.Sprintf("%v: run 'limes status'\n", grpc.ErrorDesc(err))
 		case errUnknownProfile.Error():
 			return fmt.Sprintf("%v: run 'limes assume <profile>'\n", grpc.ErrorDesc(err))
+		case errKeystorePassphrase.Error(), errKeystoreMissing.Error():
+			return fmt.Sprintf("%v\n", grpc.ErrorDesc(err))
+		case errKeystoreLocked.Error():
+			return fmt.Sprintf("%v: run 'limes keys unlock'\n", grpc.ErrorDesc(err))
+		case errNoPreviousProfile.Error():
+			return fmt.Sprintf("%v: run 'limes assume <profile>'\n", grpc.ErrorDesc(err))
+		case errLocked.Error(), errLoggedOut.Error():
+			return fmt.Sprintf("%v: run 'limes assume <profile>'\n", grpc.ErrorDesc(err))
+		case errSSOLoginNeeded.Error():
+			return fmt.Sprintf("%v: run 'limes login <profile>'\n", grpc.ErrorDesc(err))
+		case errContainerCredentialsDisabled.Error():
+			return fmt.Sprintf("%v: set 'container_port' in the configuration file\n", grpc.ErrorDesc(err))
 		}
 	case codes.Unknown:
-		switch grpc.ErrorDesc(err) {
-		case grpc.ErrClientConnClosing.Error(), grpc.ErrClientConnTimeout.Error():
+		if isServiceDown(err) {
 			return fmt.Sprintf("service down: run 'limes start'\n")
 		}
 	}
 	return fmt.Sprintf("%s\n", err)
 }
+
+// isServiceDown returns true if err is caused by the service not running
+func isServiceDown(err error) bool {
+	if grpc.Code(err) == codes.Unavailable {
+		return true
+	}
+
+	switch grpc.ErrorDesc(err) {
+	case grpc.ErrClientConnClosing.Error(), grpc.ErrClientConnTimeout.Error():
+		return grpc.Code(err) == codes.Unknown
+	}
+	return false
+}
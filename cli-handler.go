@@ -1,35 +1,54 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"os"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/aws/aws-sdk-go/service/sts"
 	pb "github.com/otm/limes/proto"
 	"golang.org/x/net/context"
 )
 
 var grpcErrorf = grpc.Errorf
 
+// isPreconditionError returns true if err is resolved by the user, e.g. with an
+// MFA token or by assuming a profile, and is returned as FailedPrecondition
+func isPreconditionError(err error) bool {
+	switch err {
+	case errMFANeeded, errUnknownProfile, errSSOLoginNeeded, errKeystoreLocked, errLocked, errLoggedOut, errNoPreviousProfile:
+		return true
+	}
+	return false
+}
+
 // CliHandler process calls from the cli tool
 type CliHandler struct {
 	address      string
+	configFile   string
 	stop         chan struct{}
 	log          Logger
 	config       Config
 	credsManager CredentialsManager
+	identity     *instanceIdentity
+	containers   ContainerService
 }
 
 // NewCliHandler returns a cliHandler
-func NewCliHandler(address string, credsManager CredentialsManager, stop chan struct{}, config Config) *CliHandler {
+func NewCliHandler(address, configFile string, credsManager CredentialsManager, stop chan struct{}, config Config, identity *instanceIdentity, containers ContainerService) *CliHandler {
 	return &CliHandler{
 		address:      address,
+		configFile:   configFile,
 		log:          &ConsoleLogger{},
 		stop:         stop,
 		credsManager: credsManager,
 		config:       config,
+		identity:     identity,
+		containers:   containers,
 	}
 }
 
@@ -55,7 +74,7 @@ func (h *CliHandler) Start() error {
 		return err
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(grpcActivity()...)
 	pb.RegisterInstanceMetaServiceServer(s, h)
 	go s.Serve(localSocket)
 
@@ -66,21 +85,34 @@ func (h *CliHandler) Start() error {
 func (h *CliHandler) Status(ctx context.Context, in *pb.Void) (*pb.StatusReply, error) {
 	creds, err := h.credsManager.GetCredentials()
 	if err != nil {
-		if err == errMFANeeded || err == errUnknownProfile {
+		if isPreconditionError(err) {
 			return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
 		}
 		return nil, err
 	}
 
-	return &pb.StatusReply{
+	return h.statusReply(creds), nil
+}
+
+// statusReply returns the status of the active role with the credentials creds
+func (h *CliHandler) statusReply(creds *sts.Credentials) *pb.StatusReply {
+	reply := &pb.StatusReply{
 		Error:           "",
 		Role:            h.credsManager.Role(),
 		AccessKeyId:     *creds.AccessKeyId,
 		SecretAccessKey: *creds.SecretAccessKey,
 		SessionToken:    *creds.SessionToken,
-		Expiration:      creds.Expiration.String(),
+		Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
 		Region:          h.credsManager.Region(),
-	}, nil
+	}
+
+	previous, revertAt := h.credsManager.ProfileStack()
+	reply.Previous = previous
+	if !revertAt.IsZero() {
+		reply.RevertAt = revertAt.Format(time.RFC3339)
+	}
+
+	return reply
 }
 
 // Stop handles the cli stop command
@@ -92,9 +124,9 @@ func (h *CliHandler) Stop(ctx context.Context, in *pb.Void) (*pb.StopReply, erro
 
 // AssumeRole will switch the current role of the metadata service
 func (h *CliHandler) AssumeRole(ctx context.Context, in *pb.AssumeRoleRequest) (*pb.StatusReply, error) {
-	err := h.credsManager.AssumeRole(in.Name, in.Mfa)
+	err := h.credsManager.SwitchRole(in.Name, in.Mfa, time.Duration(in.ForSeconds)*time.Second)
 	if err != nil {
-		if err == errMFANeeded || err == errUnknownProfile {
+		if isPreconditionError(err) {
 			return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
 		}
 		return nil, err
@@ -102,28 +134,20 @@ func (h *CliHandler) AssumeRole(ctx context.Context, in *pb.AssumeRoleRequest) (
 
 	creds, err := h.credsManager.GetCredentials()
 	if err != nil {
-		if err == errMFANeeded || err == errUnknownProfile {
+		if isPreconditionError(err) {
 			return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
 		}
 		return nil, err
 	}
 
-	return &pb.StatusReply{
-		Error:           "",
-		Role:            h.credsManager.Role(),
-		AccessKeyId:     *creds.AccessKeyId,
-		SecretAccessKey: *creds.SecretAccessKey,
-		SessionToken:    *creds.SessionToken,
-		Expiration:      creds.Expiration.String(),
-		Region:          h.credsManager.Region(),
-	}, nil
+	return h.statusReply(creds), nil
 }
 
 // RetrieveRole assumes a role, but does not update the server
 func (h *CliHandler) RetrieveRole(ctx context.Context, in *pb.AssumeRoleRequest) (*pb.StatusReply, error) {
-	creds, err := h.credsManager.RetrieveRole(in.Name, in.Mfa)
+	creds, err := h.credsManager.RetrieveRole(in.Name, in.Mfa, sessionPolicy(in.Policy))
 	if err != nil {
-		if err == errMFANeeded || err == errUnknownProfile {
+		if isPreconditionError(err) {
 			return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
 		}
 		return nil, err
@@ -135,11 +159,37 @@ func (h *CliHandler) RetrieveRole(ctx context.Context, in *pb.AssumeRoleRequest)
 		AccessKeyId:     *creds.AccessKeyId,
 		SecretAccessKey: *creds.SecretAccessKey,
 		SessionToken:    *creds.SessionToken,
-		Expiration:      creds.Expiration.String(),
+		Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
 		Region:          creds.Region,
 	}, nil
 }
 
+// Sessions lists the credentials kept by the service
+func (h *CliHandler) Sessions(ctx context.Context, in *pb.Void) (*pb.SessionsReply, error) {
+	res := &pb.SessionsReply{}
+	for _, s := range h.credsManager.Sessions() {
+		res.Sessions = append(res.Sessions, &pb.Session{
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Expiration: s.Expiration.Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
+
+// sessionPolicy converts the session policy of a request
+func sessionPolicy(p *pb.SessionPolicy) SessionPolicy {
+	if p == nil {
+		return SessionPolicy{}
+	}
+
+	return SessionPolicy{
+		Policy:     p.Policy,
+		PolicyARNs: p.PolicyArns,
+		ReadOnly:   p.ReadOnly,
+	}
+}
+
 // Config returns the current configuration
 func (h *CliHandler) Config(ctx context.Context, in *pb.Void) (*pb.ConfigReply, error) {
 	res := &pb.ConfigReply{
@@ -158,3 +208,171 @@ func (h *CliHandler) Config(ctx context.Context, in *pb.Void) (*pb.ConfigReply,
 	}
 	return res, nil
 }
+
+// Certificate returns the certificate used to sign the instance identity document
+func (h *CliHandler) Certificate(ctx context.Context, in *pb.Void) (*pb.CertificateReply, error) {
+	return &pb.CertificateReply{
+		Certificate: string(h.identity.certificatePEM()),
+	}, nil
+}
+
+// ContainerCredentials returns the information needed to use the container credentials endpoint
+func (h *CliHandler) ContainerCredentials(ctx context.Context, in *pb.Void) (*pb.ContainerCredentialsReply, error) {
+	if h.containers == nil {
+		return nil, grpcErrorf(codes.FailedPrecondition, errContainerCredentialsDisabled.Error())
+	}
+
+	return &pb.ContainerCredentialsReply{
+		FullURI:            h.containers.URI(),
+		AuthorizationToken: h.containers.Token(),
+	}, nil
+}
+
+/*
+Login runs the IAM Identity Center device authorization flow for an SSO
+profile. The code the user should verify is sent as soon as the authorization
+is started, the stream is closed when the user has logged in.
+*/
+func (h *CliHandler) Login(in *pb.LoginRequest, stream pb.InstanceMetaService_LoginServer) error {
+	profile, ok := h.config.Profiles[in.Name]
+	if !ok {
+		return grpcErrorf(codes.FailedPrecondition, errUnknownProfile.Error())
+	}
+
+	if !profile.sso() {
+		return grpcErrorf(codes.InvalidArgument, "not an SSO profile: %v", in.Name)
+	}
+
+	token, auth, err := ssoStartLogin(profile)
+	if err != nil {
+		return err
+	}
+
+	err = stream.Send(&pb.LoginReply{
+		VerificationURI:         auth.VerificationURI,
+		VerificationURIComplete: auth.VerificationURIComplete,
+		UserCode:                auth.UserCode,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ssoWaitLogin(profile, token, auth)
+	if err != nil {
+		return err
+	}
+
+	h.resume()
+	return nil
+}
+
+// Unlock decrypts the keystore and keeps the keys in memory
+func (h *CliHandler) Unlock(ctx context.Context, in *pb.UnlockRequest) (*pb.Void, error) {
+	err := unlockKeystore(in.Passphrase)
+	if err == errKeystorePassphrase || err == errKeystoreMissing {
+		return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.resume()
+	return &pb.Void{}, nil
+}
+
+/*
+ReloadConfig reads the configuration file again, e.g. after the keys of a
+profile have been rotated. The profiles are updated, while the sessions
+already created are kept until they are renewed.
+*/
+func (h *CliHandler) ReloadConfig(ctx context.Context, in *pb.Void) (*pb.Void, error) {
+	if h.configFile == "" {
+		return &pb.Void{}, nil
+	}
+
+	config, err := readConfig(h.configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.check(); err != nil {
+		return nil, fmt.Errorf("error in config file: %v", err)
+	}
+
+	h.credsManager.ReloadConfig(config)
+	h.config = config
+
+	return &pb.Void{}, nil
+}
+
+// PendingMFA lists the MFA tokens the service is waiting for
+func (h *CliHandler) PendingMFA(ctx context.Context, in *pb.Void) (*pb.PendingMFAReply, error) {
+	res := &pb.PendingMFAReply{}
+	for _, req := range h.credsManager.PendingMFA() {
+		res.Requests = append(res.Requests, &pb.MFARequest{
+			Id:      req.ID,
+			Profile: req.Profile,
+			Serial:  req.Serial,
+			Created: req.Created.Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
+
+// AnswerMFA renews the credentials waiting for an MFA token
+func (h *CliHandler) AnswerMFA(ctx context.Context, in *pb.AnswerMFARequest) (*pb.Void, error) {
+	err := h.credsManager.AnswerMFA(in.Id, in.Mfa)
+	if err == errNoMFARequest || err == errMFARequestDropped {
+		return nil, grpcErrorf(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Void{}, nil
+}
+
+// Lock makes the service forget all credentials until a profile is assumed again
+func (h *CliHandler) Lock(ctx context.Context, in *pb.Void) (*pb.Void, error) {
+	if err := h.lock(); err != nil {
+		return nil, err
+	}
+
+	return &pb.Void{}, nil
+}
+
+/*
+lock forgets the credentials in memory and in the session cache, and locks the
+keystore. It is also called when the service has been idle for idle_lock
+minutes.
+*/
+func (h *CliHandler) lock() error {
+	lockKeystore()
+	return h.credsManager.Lock()
+}
+
+// Logout locks the service, forgets the active profile and removes the SSO tokens
+func (h *CliHandler) Logout(ctx context.Context, in *pb.Void) (*pb.Void, error) {
+	lockKeystore()
+	if err := h.credsManager.Logout(); err != nil {
+		return nil, err
+	}
+
+	if err := removeSSOTokens(); err != nil {
+		return nil, err
+	}
+
+	return &pb.Void{}, nil
+}
+
+// resume assumes the active role again if it is waiting for e.g. a login
+func (h *CliHandler) resume() {
+	if _, err := h.credsManager.GetCredentials(); err == nil {
+		return
+	}
+
+	if role := h.credsManager.Role(); role != "" {
+		err := h.credsManager.AssumeRole(role, "")
+		h.log.Debug("resuming %v: %v\n", role, err)
+	}
+}
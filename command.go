@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// shellCommand returns a command running command with the system shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+/*
+commandOutput runs command with the system shell and returns its output with
+surrounding white space removed. Anything written to stderr by the command is
+included in the returned error.
+*/
+func commandOutput(command string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := shellCommand(command)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %v: %v", command, err, msg)
+		}
+		return "", fmt.Errorf("%v: %v", command, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
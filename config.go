@@ -8,14 +8,63 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+
+	"gopkg.in/yaml.v2"
 )
 
 // Config hold configuration read from the configuration file
 type Config struct {
-	Port    int    `yaml:"port"`
-	Address string `yaml:"address"`
+	Port                int      `yaml:"port"`
+	ContainerPort       int      `yaml:"container_port"`
+	Address             string   `yaml:"address"`
+	RequireIMDSv2       bool     `yaml:"require_imdsv2"`
+	MFAAskpass          string   `yaml:"mfa_askpass"`
+	DisableSessionCache bool     `yaml:"disable_session_cache"`
+	IdleLock            int      `yaml:"idle_lock"`
+	Metadata            Metadata `yaml:"metadata"`
 	Profiles
+
+	// legacyFormat is true if the profiles are not under a profiles key
+	legacyFormat bool
+}
+
+// readConfig reads the configuration file at path
+func readConfig(path string) (Config, error) {
+	config := Config{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+
+	// fall back to the old format without a profiles key
+	if len(config.Profiles) == 0 {
+		if err := yaml.Unmarshal(data, &config.Profiles); err != nil {
+			return config, err
+		}
+		config.legacyFormat = len(config.Profiles) > 0
+	}
+
+	return config, nil
+}
+
+// check returns an error if the profiles of the configuration are invalid
+func (c Config) check() error {
+	if err := c.Profiles.checkSourceProfiles(); err != nil {
+		return err
+	}
+
+	if err := c.Profiles.checkCredentialSources(); err != nil {
+		return err
+	}
+
+	return c.Profiles.checkRoleSessions()
 }
 
 // NewConfig returns a new Config struct
@@ -32,21 +81,164 @@ type Profiles map[string]Profile
 
 // Profile defines an AWS IAM profile
 type Profile struct {
-	AwsAccessKeyID     string `yaml:"aws_access_key_id"`
-	AwsSecretAccessKey string `yaml:"aws_secret_access_key"`
-	AwsSessionToken    string
-	Region             string `yaml:"region"`
-	MFASerial          string `yaml:"mfa_serial"`
-	RoleARN            string `yaml:"role_arn"`
-	SourceProfile      string `yaml:"source_profile"`
-	RoleSessionName    string `yaml:"role_session_name"`
-	Protected          bool   `yaml:"protected"`
+	AwsAccessKeyID           string `yaml:"aws_access_key_id"`
+	AwsSecretAccessKey       string `yaml:"aws_secret_access_key"`
+	AwsSessionToken          string
+	Region                   string   `yaml:"region"`
+	MFASerial                string   `yaml:"mfa_serial"`
+	MFATOTPCommand           string   `yaml:"mfa_totp_command"`
+	RoleARN                  string   `yaml:"role_arn"`
+	SourceProfile            string   `yaml:"source_profile"`
+	RoleSessionName          string   `yaml:"role_session_name"`
+	DurationSeconds          int64    `yaml:"duration_seconds"`
+	ExternalID               string   `yaml:"external_id"`
+	Policy                   string   `yaml:"policy"`
+	PolicyARNs               []string `yaml:"policy_arns"`
+	ReadOnly                 bool     `yaml:"read_only"`
+	WebIdentityTokenFile     string   `yaml:"web_identity_token_file"`
+	WebIdentityTokenCommand  string   `yaml:"web_identity_token_command"`
+	SAMLRoleARN              string   `yaml:"saml_role_arn"`
+	SAMLPrincipalARN         string   `yaml:"saml_principal_arn"`
+	SAMLAssertionCommand     string   `yaml:"saml_assertion_command"`
+	SAMLAssertionFile        string   `yaml:"saml_assertion_file"`
+	SSOStartURL              string   `yaml:"sso_start_url"`
+	SSORegion                string   `yaml:"sso_region"`
+	SSOAccountID             string   `yaml:"sso_account_id"`
+	SSORoleName              string   `yaml:"sso_role_name"`
+	SSOOIDCEndpoint          string   `yaml:"sso_oidc_endpoint"`
+	SSOPortalEndpoint        string   `yaml:"sso_portal_endpoint"`
+	CredentialSource         string   `yaml:"credential_source"`
+	SharedCredentialsFile    string   `yaml:"shared_credentials_file"`
+	SharedCredentialsProfile string   `yaml:"shared_credentials_profile"`
+	CredentialProcess        string   `yaml:"credential_process"`
+	VaultAddress             string   `yaml:"vault_address"`
+	VaultPath                string   `yaml:"vault_path"`
+	VaultTokenFile           string   `yaml:"vault_token_file"`
+	IAMEndpoint              string   `yaml:"iam_endpoint"`
+	STSEndpoint              string   `yaml:"sts_endpoint"`
+	Protected                bool     `yaml:"protected"`
+	Metadata                 Metadata `yaml:"metadata"`
 }
 
 func (p Profile) protected() bool {
 	return p.Protected
 }
 
+/*
+renewable returns true if the session credentials of p can be fetched again
+without user interaction, i.e. without an MFA token or with an MFA token
+generated by limes.
+*/
+func (p Profile) renewable() bool {
+	if p.webIdentity() || p.saml() || p.sso() || p.MFATOTPCommand != "" {
+		return true
+	}
+
+	switch p.CredentialSource {
+	case credentialSourceProcess, credentialSourceVault:
+		return p.MFASerial == ""
+	}
+	return false
+}
+
+/*
+sourceChain returns the profiles that are used to reach the profile name. The
+chain starts with the profile holding the long term credentials, i.e. the
+profile without a source_profile, followed by the roles assumed in order and
+ends with name.
+*/
+func (p Profiles) sourceChain(name string) ([]string, error) {
+	if _, ok := p[name]; !ok {
+		return nil, errUnknownProfile
+	}
+
+	chain := []string{}
+	seen := make(map[string]bool)
+	for current := name; current != ""; current = p[current].SourceProfile {
+		if seen[current] {
+			return nil, fmt.Errorf("source_profile cycle: %v -> %v", strings.Join(chain, " -> "), current)
+		}
+		if _, ok := p[current]; !ok {
+			return nil, fmt.Errorf("unknown source_profile: %v", current)
+		}
+		seen[current] = true
+		chain = append(chain, current)
+	}
+
+	// reverse the chain to start with the source profile
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return chain, nil
+}
+
+// names returns the sorted names of the profiles
+func (p Profiles) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkSourceProfiles verifies that the source_profile chains of all profiles are valid
+func (p Profiles) checkSourceProfiles() error {
+	for _, name := range p.names() {
+		if _, err := p.sourceChain(name); err != nil {
+			return fmt.Errorf("profile %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Metadata defines values served by the instance metadata service
+type Metadata struct {
+	InstanceID       string            `yaml:"instance_id"`
+	AvailabilityZone string            `yaml:"availability_zone"`
+	InstanceType     string            `yaml:"instance_type"`
+	Hostname         string            `yaml:"hostname"`
+	AMIID            string            `yaml:"ami_id"`
+	Tags             map[string]string `yaml:"tags"`
+	UserData         string            `yaml:"user_data"`
+	UserDataFile     string            `yaml:"user_data_file"`
+}
+
+// override returns a copy of m where the values set in o replaces the values in m
+func (m Metadata) override(o Metadata) Metadata {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+
+	set(&m.InstanceID, o.InstanceID)
+	set(&m.AvailabilityZone, o.AvailabilityZone)
+	set(&m.InstanceType, o.InstanceType)
+	set(&m.Hostname, o.Hostname)
+	set(&m.AMIID, o.AMIID)
+
+	if o.UserData != "" || o.UserDataFile != "" {
+		m.UserData = o.UserData
+		m.UserDataFile = o.UserDataFile
+	}
+
+	if len(o.Tags) > 0 {
+		tags := make(map[string]string, len(m.Tags)+len(o.Tags))
+		for k, v := range m.Tags {
+			tags[k] = v
+		}
+		for k, v := range o.Tags {
+			tags[k] = v
+		}
+		m.Tags = tags
+	}
+
+	return m
+}
+
 const (
 	awsConfDir         = ".aws"
 	awsConfigFile      = "config"
@@ -258,14 +450,24 @@ func homeDir() (homeDir string, err error) {
 	return "", fmt.Errorf("fallback failed, set `HOME` environment variable")
 }
 
-func writeAwsConfig(region string) error {
+// awsConfigPath returns the path of the AWS config file
+func awsConfigPath() (string, error) {
 	configFile := os.Getenv("AWS_CONFIG_FILE")
-	if configFile == "" {
-		home, err := homeDir()
-		if err != nil {
-			return err
-		}
-		configFile = filepath.Join(home, awsConfDir, awsConfigFile)
+	if configFile != "" {
+		return configFile, nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, awsConfDir, awsConfigFile), nil
+}
+
+func writeAwsConfig(region string) error {
+	configFile, err := awsConfigPath()
+	if err != nil {
+		return err
 	}
 
 	active, err := activeAWSConfigFile()
@@ -283,8 +485,17 @@ func writeAwsConfig(region string) error {
 		}
 	}
 
-	conf := []byte(fmt.Sprintf("[default]\nregion=%s\n%s", region, limesConfFlag))
-	ioutil.WriteFile(configFile, conf, 0600)
+	// keep the profiles written by `limes configure-aws`
+	var managed []string
+	if data, err := ioutil.ReadFile(configFile); err == nil {
+		_, managed = splitManagedAWSProfiles(data)
+	}
+
+	conf := fmt.Sprintf("[default]\nregion=%s\n%s", region, limesConfFlag)
+	if len(managed) > 0 {
+		conf += "\n\n" + strings.Join(managed, "\n") + "\n"
+	}
+	ioutil.WriteFile(configFile, []byte(conf), 0600)
 
 	return nil
 }
@@ -319,3 +530,116 @@ func writeAwsCredentials(region string) error {
 
 	return nil
 }
+
+// Markers around the profiles written to the AWS config file by `limes configure-aws`
+const (
+	awsManagedBegin = "# BEGIN limes managed profiles, changes will be overwritten"
+	awsManagedEnd   = "# END limes managed profiles"
+)
+
+// awsProfile is a profile written to the AWS config file
+type awsProfile struct {
+	Name              string
+	Region            string
+	CredentialProcess string
+}
+
+/*
+splitManagedAWSProfiles splits the lines of an AWS config file in the lines
+written by the user and the block of profiles managed by limes, including
+the markers.
+*/
+func splitManagedAWSProfiles(data []byte) (user, managed []string) {
+	inBlock := false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		txt := scanner.Text()
+		switch {
+		case strings.TrimSpace(txt) == awsManagedBegin:
+			inBlock = true
+			managed = append(managed, txt)
+		case inBlock:
+			managed = append(managed, txt)
+			if strings.TrimSpace(txt) == awsManagedEnd {
+				inBlock = false
+			}
+		default:
+			user = append(user, txt)
+		}
+	}
+
+	return user, managed
+}
+
+// awsConfigSections returns the profile names of the sections in lines
+func awsConfigSections(lines []string) map[string]bool {
+	sections := make(map[string]bool)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		name := strings.TrimSpace(line[1 : len(line)-1])
+		if strings.HasPrefix(name, "profile ") {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+		}
+		sections[name] = true
+	}
+
+	return sections
+}
+
+/*
+configureAWSProfiles writes profiles to the AWS config file at path. Profiles
+written by an earlier run are replaced and the rest of the file is left as
+is. Profiles that the user already has a section for are not written, their
+names are returned in skipped.
+*/
+func configureAWSProfiles(path string, profiles []awsProfile) (skipped []string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	user, _ := splitManagedAWSProfiles(data)
+	for len(user) > 0 && strings.TrimSpace(user[len(user)-1]) == "" {
+		user = user[:len(user)-1]
+	}
+	existing := awsConfigSections(user)
+
+	managed := []string{awsManagedBegin}
+	for _, profile := range profiles {
+		if existing[profile.Name] {
+			skipped = append(skipped, profile.Name)
+			continue
+		}
+
+		managed = append(managed, fmt.Sprintf("[profile %s]", profile.Name))
+		if profile.Region != "" {
+			managed = append(managed, fmt.Sprintf("region = %s", profile.Region))
+		}
+		managed = append(managed, fmt.Sprintf("credential_process = %s", profile.CredentialProcess), "")
+	}
+	managed = append(managed, awsManagedEnd)
+
+	lines := user
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, managed...)
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// write to a temporary file first to never leave a truncated config behind
+	tmp := path + ".limes-tmp"
+	err = ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return skipped, os.Rename(tmp, path)
+}
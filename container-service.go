@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Environment variables read by the AWS SDKs to locate a container credentials endpoint
+const (
+	containerCredentialsURIEnv   = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	containerAuthorizationEnv    = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+	containerCredentialsHost     = "127.0.0.1"
+	containerCredentialsEndpoint = "/v1/credentials"
+)
+
+var errContainerCredentialsDisabled = fmt.Errorf("Container credentials disabled")
+
+/*
+ContainerService extends Service with the information clients need to locate
+and authenticate with the container credentials endpoint.
+*/
+type ContainerService interface {
+	Service
+	URI() string
+	Token() string
+}
+
+/*
+containerService emulates the credentials endpoint used by ECS tasks and EKS
+pods. Clients find the endpoint with AWS_CONTAINER_CREDENTIALS_FULL_URI and
+authenticate with the token in AWS_CONTAINER_AUTHORIZATION_TOKEN.
+
+As the endpoint listens on 127.0.0.1 it does not require the 169.254.169.254
+alias on the loop back device, nor a privileged port.
+*/
+type containerService struct {
+	listener net.Listener
+	creds    CredentialsSource
+	config   Config
+	token    string
+}
+
+/*
+NewContainerService returns a containerService serving credentials from creds
+on listener.
+*/
+func NewContainerService(listener net.Listener, creds CredentialsSource, config Config) (ContainerService, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &containerService{
+		listener: listener,
+		creds:    creds,
+		config:   config,
+		token:    token,
+	}, nil
+}
+
+func (cs *containerService) Start() error {
+	go cs.listen()
+	return nil
+}
+
+func (cs *containerService) listen() {
+	handler := http.NewServeMux()
+	handler.HandleFunc(containerCredentialsEndpoint, cs.getCredentials)
+
+	err := http.Serve(cs.listener, trackActivity(handler))
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "use of closed network connection") {
+			// this happens when Close() is called, and it's normal
+			return
+		}
+		panic(err)
+	}
+}
+
+func (cs *containerService) Stop() error {
+	return cs.listener.Close()
+}
+
+// URI returns the value for AWS_CONTAINER_CREDENTIALS_FULL_URI
+func (cs *containerService) URI() string {
+	return fmt.Sprintf("http://%v%v", cs.listener.Addr(), containerCredentialsEndpoint)
+}
+
+// Token returns the value for AWS_CONTAINER_AUTHORIZATION_TOKEN
+func (cs *containerService) Token() string {
+	return cs.token
+}
+
+/*
+Returns credentials for clients presenting the authorization token.
+*/
+func (cs *containerService) getCredentials(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(cs.token)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := cs.creds.GetCredentials()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	resp := &containerCredentialsResponse{
+		AccessKeyID:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		Token:           *creds.SessionToken,
+		Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
+		RoleArn:         cs.config.Profiles[cs.creds.Role()].RoleARN,
+	}
+	respBody, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
+}
+
+/*
+Structure encoded as JSON for container credential clients.
+*/
+type containerCredentialsResponse struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+	RoleArn         string `json:"RoleArn,omitempty"`
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// credentialSourceProcess runs an external command printing credentials
+const credentialSourceProcess = "process"
+
+/*
+processBackend runs the credential_process of a profile. The command prints
+credentials in the same JSON format as used by `credential_process` in the
+AWS configuration.
+*/
+type processBackend struct {
+	command string
+}
+
+func (b *processBackend) Retrieve() (credentials.Value, time.Time, error) {
+	output, err := commandOutput(b.command)
+	if err != nil {
+		return credentials.Value{}, time.Time{}, err
+	}
+
+	resp := credentialProcessResponse{}
+	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("invalid output from credential_process: %v", err)
+	}
+
+	if resp.Version != 1 {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("unsupported credential_process version: %v", resp.Version)
+	}
+
+	var expires time.Time
+	if resp.Expiration != "" {
+		expires, err = time.Parse(time.RFC3339, resp.Expiration)
+		if err != nil {
+			return credentials.Value{}, time.Time{}, fmt.Errorf("invalid expiration from credential_process: %v", err)
+		}
+	}
+
+	return credentials.Value{
+		AccessKeyID:     resp.AccessKeyID,
+		SecretAccessKey: resp.SecretAccessKey,
+		SessionToken:    resp.SessionToken,
+	}, expires, nil
+}
+
+func init() {
+	registerCredentialBackend(credentialSourceProcess, func(name string, p Profile) (CredentialBackend, error) {
+		if p.CredentialProcess == "" {
+			return nil, fmt.Errorf("credential_process is required with credential_source: %v", credentialSourceProcess)
+		}
+		return &processBackend{command: p.CredentialProcess}, nil
+	})
+}
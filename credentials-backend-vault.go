@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Settings for fetching credentials from the HashiCorp Vault AWS secrets engine
+const (
+	credentialSourceVault = "vault"
+	vaultAddrEnv          = "VAULT_ADDR"
+	vaultTokenEnv         = "VAULT_TOKEN"
+	vaultTokenFile        = ".vault-token"
+	vaultTokenHeader      = "X-Vault-Token"
+)
+
+/*
+vaultBackend reads credentials from an AWS secrets engine path in Vault, e.g.
+`aws/creds/my-role` or `aws/sts/my-role`.
+*/
+type vaultBackend struct {
+	address   string
+	path      string
+	tokenFile string
+}
+
+// token returns the Vault token from the environment or the token file
+func (b *vaultBackend) token() (string, error) {
+	if token := os.Getenv(vaultTokenEnv); token != "" && b.tokenFile == "" {
+		return token, nil
+	}
+
+	path := b.tokenFile
+	if path == "" {
+		home, err := homeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, vaultTokenFile)
+	}
+
+	token, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read vault token: %v", err)
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
+
+func (b *vaultBackend) Retrieve() (credentials.Value, time.Time, error) {
+	token, err := b.token()
+	if err != nil {
+		return credentials.Value{}, time.Time{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, b.address+"/v1/"+b.path, nil)
+	if err != nil {
+		return credentials.Value{}, time.Time{}, err
+	}
+	req.Header.Set(vaultTokenHeader, token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return credentials.Value{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var secret struct {
+		LeaseDuration int64 `json:"lease_duration"`
+		Data          struct {
+			AccessKey     string `json:"access_key"`
+			SecretKey     string `json:"secret_key"`
+			SecurityToken string `json:"security_token"`
+		} `json:"data"`
+		Errors []string `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("invalid response from vault: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("vault: %v: %v", resp.Status, strings.Join(secret.Errors, ", "))
+	}
+
+	var expires time.Time
+	if secret.LeaseDuration > 0 {
+		expires = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     secret.Data.AccessKey,
+		SecretAccessKey: secret.Data.SecretKey,
+		SessionToken:    secret.Data.SecurityToken,
+	}, expires, nil
+}
+
+func init() {
+	registerCredentialBackend(credentialSourceVault, func(name string, p Profile) (CredentialBackend, error) {
+		address := p.VaultAddress
+		if address == "" {
+			address = os.Getenv(vaultAddrEnv)
+		}
+		if address == "" || p.VaultPath == "" {
+			return nil, fmt.Errorf("vault_address (or %v) and vault_path are required with credential_source: %v", vaultAddrEnv, credentialSourceVault)
+		}
+
+		return &vaultBackend{
+			address:   strings.TrimSuffix(address, "/"),
+			path:      strings.TrimPrefix(p.VaultPath, "/"),
+			tokenFile: p.VaultTokenFile,
+		}, nil
+	})
+}
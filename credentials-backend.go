@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// credentialSourceStatic reads the keys from the profile in the configuration file
+const credentialSourceStatic = "static"
+
+/*
+CredentialBackend provides the credentials a base profile starts from, e.g.
+long term keys that are exchanged for a session with GetSessionToken. The
+backend of a profile is selected with `credential_source`.
+*/
+type CredentialBackend interface {
+	// Retrieve returns the credentials and when they expire, expires is zero
+	// for long term keys
+	Retrieve() (creds credentials.Value, expires time.Time, err error)
+}
+
+type credentialBackendFactory func(name string, profile Profile) (CredentialBackend, error)
+
+// credentialBackends are the registered backends by credential_source name
+var credentialBackends = make(map[string]credentialBackendFactory)
+
+// registerCredentialBackend makes a backend available as credential_source
+func registerCredentialBackend(source string, factory credentialBackendFactory) {
+	credentialBackends[source] = factory
+}
+
+func credentialBackendNames() []string {
+	names := make([]string, 0, len(credentialBackends))
+	for name := range credentialBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// credentialBackend returns the backend selected by the credential_source of p, name is the name of p
+func (p Profile) credentialBackend(name string) (CredentialBackend, error) {
+	source := p.CredentialSource
+	if source == "" {
+		source = credentialSourceStatic
+	}
+
+	factory, ok := credentialBackends[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown credential_source: %v, valid sources: %v", source, credentialBackendNames())
+	}
+
+	return factory(name, p)
+}
+
+// checkCredentialSources verifies that the credential_source of all profiles are valid
+func (p Profiles) checkCredentialSources() error {
+	for _, name := range p.names() {
+		if _, err := p[name].credentialBackend(name); err != nil {
+			return fmt.Errorf("profile %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+providerBackend adapts the credential providers of the AWS SDK, which are
+used for the static, environment and shared file backends.
+*/
+type providerBackend struct {
+	provider credentials.Provider
+}
+
+func (b *providerBackend) Retrieve() (credentials.Value, time.Time, error) {
+	creds, err := b.provider.Retrieve()
+	return creds, time.Time{}, err
+}
+
+func init() {
+	registerCredentialBackend(credentialSourceStatic, func(name string, p Profile) (CredentialBackend, error) {
+		return &providerBackend{&credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     p.AwsAccessKeyID,
+			SecretAccessKey: p.AwsSecretAccessKey,
+			SessionToken:    p.AwsSessionToken,
+		}}}, nil
+	})
+
+	registerCredentialBackend("env", func(name string, p Profile) (CredentialBackend, error) {
+		return &providerBackend{&credentials.EnvProvider{}}, nil
+	})
+
+	registerCredentialBackend("shared", func(name string, p Profile) (CredentialBackend, error) {
+		return &providerBackend{&credentials.SharedCredentialsProvider{
+			Filename: p.SharedCredentialsFile,
+			Profile:  p.SharedCredentialsProfile,
+		}}, nil
+	})
+}
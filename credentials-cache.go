@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+roleCache keeps the credentials retrieved for roles with RetrieveRole, until
+shortly before they expire. Credentials limited by a session policy are kept
+apart from the unrestricted credentials of the role. Concurrent requests for
+the same role are coalesced, so that only one of them calls STS and the others
+wait for the result.
+*/
+type roleCache struct {
+	lock     sync.Mutex
+	roles    map[string]*cachedRole
+	inflight map[string]*roleCall
+
+	// generation is bumped by forget, credentials retrieved before are not cached
+	generation int
+}
+
+// cachedRole are the credentials of a role in the cache
+type cachedRole struct {
+	name       string
+	restricted bool
+	creds      *AwsCredentials
+}
+
+// roleCall is a request for the credentials of a role in progress
+type roleCall struct {
+	done  chan struct{}
+	creds *AwsCredentials
+	err   error
+}
+
+// cachedCredentialsValid returns true if creds can be handed out from the cache
+func cachedCredentialsValid(creds *AwsCredentials) bool {
+	return time.Now().Add(credentialsRefreshWindow).Before(*creds.Expiration)
+}
+
+/*
+get returns the cached credentials of the role name with the session policy
+policy, or calls retrieve if they are missing or about to expire. Calls with
+the same name, policy and MFA share the result of the call already in
+progress.
+*/
+func (c *roleCache) get(name string, policy SessionPolicy, MFA string, retrieve func() (*AwsCredentials, error)) (*AwsCredentials, error) {
+	roleKey := name + "\x00" + policy.key()
+
+	c.lock.Lock()
+	if role, ok := c.roles[roleKey]; ok && cachedCredentialsValid(role.creds) {
+		c.lock.Unlock()
+		return copyAwsCredentials(role.creds), nil
+	}
+
+	key := roleKey + "\x00" + MFA
+	if call, ok := c.inflight[key]; ok {
+		c.lock.Unlock()
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyAwsCredentials(call.creds), nil
+	}
+
+	call := &roleCall{done: make(chan struct{})}
+	if c.inflight == nil {
+		c.inflight = make(map[string]*roleCall)
+	}
+	c.inflight[key] = call
+	generation := c.generation
+	c.lock.Unlock()
+
+	call.creds, call.err = retrieve()
+
+	c.lock.Lock()
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+	}
+	if call.err == nil && c.generation == generation {
+		if c.roles == nil {
+			c.roles = make(map[string]*cachedRole)
+		}
+		c.roles[roleKey] = &cachedRole{
+			name:       name,
+			restricted: !policy.empty(),
+			creds:      call.creds,
+		}
+	}
+	c.lock.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	return copyAwsCredentials(call.creds), nil
+}
+
+// forget removes all cached credentials, and the credentials of the calls in
+// progress are not cached
+func (c *roleCache) forget() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.roles = nil
+	c.inflight = nil
+	c.generation++
+}
+
+// prune removes credentials that are about to expire
+func (c *roleCache) prune() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, role := range c.roles {
+		if !cachedCredentialsValid(role.creds) {
+			delete(c.roles, key)
+		}
+	}
+}
+
+// sessions lists the cached credentials
+func (c *roleCache) sessions() []SessionInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	res := make([]SessionInfo, 0, len(c.roles))
+	for _, role := range c.roles {
+		kind := sessionRole
+		if role.restricted {
+			kind = sessionRestricted
+		}
+		res = append(res, SessionInfo{Name: role.name, Kind: kind, Expiration: *role.creds.Expiration})
+	}
+	return res
+}
+
+// copyAwsCredentials returns a copy of creds, so that cached credentials are
+// never modified by the receiver
+func copyAwsCredentials(creds *AwsCredentials) *AwsCredentials {
+	c := *creds
+	return &c
+}
@@ -26,13 +26,27 @@ func (m *FakeCredentialsManager) AssumeRole(name, mfa string) error {
 	return nil
 }
 
+// SwitchRole does nothing
+func (m *FakeCredentialsManager) SwitchRole(name, mfa string, d time.Duration) error {
+	return nil
+}
+
+// ProfileStack returns no previous profiles
+func (m *FakeCredentialsManager) ProfileStack() ([]string, time.Time) {
+	return nil, time.Time{}
+}
+
+// ReloadConfig does nothing
+func (m *FakeCredentialsManager) ReloadConfig(conf Config) {
+}
+
 // SetSourceProfile does nothing
 func (m *FakeCredentialsManager) SetSourceProfile(name, mfa string) error {
 	return nil
 }
 
 // RetrieveRole return a dummy role
-func (m *FakeCredentialsManager) RetrieveRole(name, MFA string) (*AwsCredentials, error) {
+func (m *FakeCredentialsManager) RetrieveRole(name, MFA string, policy SessionPolicy) (*AwsCredentials, error) {
 	c, _ := m.GetCredentials()
 	return &AwsCredentials{
 		Credentials: *c,
@@ -59,3 +73,29 @@ func (m *FakeCredentialsManager) GetCredentials() (*sts.Credentials, error) {
 		SessionToken:    aws.String("xxxxxxxxxxx-yyyyyyyyyyy-zzzzzzzzzzzz"),
 	}, nil
 }
+
+// PendingMFA returns no requests, the fake credentials never expire
+func (m *FakeCredentialsManager) PendingMFA() []mfaRequest {
+	return nil
+}
+
+// AnswerMFA does nothing
+func (m *FakeCredentialsManager) AnswerMFA(id int64, mfa string) error {
+	return errNoMFARequest
+}
+
+// Sessions returns the dummy credentials
+func (m *FakeCredentialsManager) Sessions() []SessionInfo {
+	c, _ := m.GetCredentials()
+	return []SessionInfo{{Name: m.Role(), Kind: sessionActive, Expiration: *c.Expiration}}
+}
+
+// Lock does nothing
+func (m *FakeCredentialsManager) Lock() error {
+	return nil
+}
+
+// Logout does nothing
+func (m *FakeCredentialsManager) Logout() error {
+	return nil
+}
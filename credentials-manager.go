@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -41,6 +42,9 @@ func isFatalError(err error) bool {
 	return ok
 }
 
+// credentialsRefreshWindow is how long before expiration credentials are renewed
+const credentialsRefreshWindow = 600 * time.Second
+
 // AwsCredentials is a wrapper of sts.Credentials that adds Region
 type AwsCredentials struct {
 	sts.Credentials
@@ -50,13 +54,39 @@ type AwsCredentials struct {
 // CredentialsManager provides an interface
 type CredentialsManager interface {
 	Role() string
-	RetrieveRole(name, MFA string) (*AwsCredentials, error)
+	RetrieveRole(name, MFA string, policy SessionPolicy) (*AwsCredentials, error)
 	RetrieveRoleARN(RoleARN, MFASerial, MFA string) (*sts.Credentials, error)
 	AssumeRole(name, mfa string) error
+	SwitchRole(name, mfa string, d time.Duration) error
+	ProfileStack() ([]string, time.Time)
 	AssumeRoleARN(name, RoleARN, MFASerial, MFA string) error
 	GetCredentials() (*sts.Credentials, error)
 	SetSourceProfile(name, mfa string) error
+	ReloadConfig(conf Config)
 	Region() string
+	Sessions() []SessionInfo
+	PendingMFA() []mfaRequest
+	AnswerMFA(id int64, mfa string) error
+	Lock() error
+	Logout() error
+}
+
+// Kinds of sessions kept by the credentials manager
+const (
+	sessionActive = "active"
+	sessionBase   = "base"
+	sessionChain  = "chain"
+	sessionRole   = "role"
+
+	// sessionRestricted are role credentials limited by a session policy
+	sessionRestricted = "restricted"
+)
+
+// SessionInfo describes a set of credentials kept by the credentials manager
+type SessionInfo struct {
+	Name       string
+	Kind       string
+	Expiration time.Time
 }
 
 // CredentialsExpirationManager is responsible for renewing a set of credentials
@@ -66,38 +96,130 @@ type CredentialsExpirationManager struct {
 	// config is the loaded configuration
 	config Config
 
-	// profile is the current base profile
-	sourceProfile     Profile
-	sourceProfileName string
-
 	// err is the current internal error
 	err error
 
-	// This is the default session and information
-	sourceSession     *session.Session
-	sourceCredentials *sts.Credentials
-	sourceSTSClient   *sts.STS
+	// source is the session of the current base profile
+	source *sourceSession
+
+	// sessions are the sessions of all base profiles in use, by profile name
+	sessions map[string]*sourceSession
+
+	// roles are the credentials handed out by RetrieveRole
+	roles roleCache
+
+	// mfa are the MFA tokens needed to renew credentials in the background
+	mfa mfaQueue
+
+	// cache keeps the sessions across restarts, nil if disabled
+	cache *sessionCache
+
+	// stack are the profiles assumed before the active one
+	stack profileStack
+
+	// renewing is held while credentials are renewed in the background, so
+	// that Lock and Logout do not race with a renewal
+	renewing sync.Mutex
+
+	// generation is bumped when the credentials are forgotten, so that
+	// credentials retrieved across Lock or Logout are dropped
+	generation int
 
 	// This is the current active credentials
 	role        string
 	credentials *sts.Credentials
 }
 
-// NewCredentialsExpirationManager returns a credentialsExpirationManager
-// It creates a session, then it will call GetSessionToken to retrieve a pair of
-// temporary credentials.
-func NewCredentialsExpirationManager(profileName string, conf Config, mfa string) *CredentialsExpirationManager {
-	cm := newTemporaryCredentialsManager(profileName, conf, mfa)
+/*
+sourceSession is the session of a base profile, together with the cached
+credentials of the intermediate roles assumed with it. A session is kept for
+every base profile in use, so that roles with different base profiles can be
+used without a new MFA token until the session expires.
+*/
+type sourceSession struct {
+	name        string
+	profile     Profile
+	credentials *sts.Credentials
+	client      *sts.STS
 
-	go cm.Refresher()
-	return cm
+	// hops are the credentials of the intermediate roles in source_profile
+	// chains, e.g. `hub` when `prod` has `hub` as source profile
+	hops map[string]*sts.Credentials
 }
 
-func newTemporaryCredentialsManager(profileName string, conf Config, mfa string) *CredentialsExpirationManager {
+// newSourceSession fetches the session credentials of the base profile name
+func newSourceSession(name string, profile Profile, mfa string) (*sourceSession, error) {
+	creds, err := sourceProfileCredentials(name, profile, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sourceSession{
+		name:        name,
+		profile:     profile,
+		credentials: creds,
+		hops:        make(map[string]*sts.Credentials),
+	}
+	s.client = s.stsClient(creds)
+
+	return s, nil
+}
+
+// stsClient returns an STS client using creds
+func (s *sourceSession) stsClient(creds *sts.Credentials) *sts.STS {
+	cfg := &aws.Config{
+		Region: aws.String(s.profile.Region),
+		Credentials: credentials.NewStaticCredentials(
+			*creds.AccessKeyId,
+			*creds.SecretAccessKey,
+			*creds.SessionToken,
+		),
+	}
+	if s.profile.STSEndpoint != "" {
+		cfg.Endpoint = aws.String(s.profile.STSEndpoint)
+	}
+	return sts.New(session.New(cfg))
+}
+
+// expired returns true if the session has to be renewed before it is used
+func (s *sourceSession) expired() bool {
+	// renew ahead of time when it can be done without asking the user
+	expires := *s.credentials.Expiration
+	if s.profile.renewable() {
+		expires = expires.Add(-credentialsRefreshWindow)
+	}
+	return expires.Before(time.Now())
+}
+
+// NewCredentialsExpirationManager returns a credentialsExpirationManager
+// It resumes the sessions in the session cache, or creates a session, then it
+// will call GetSessionToken to retrieve a pair of temporary credentials. The
+// cached profile is only resumed if neither profileName nor mfa is given, and
+// the cache is not used at all if mfa is given.
+func NewCredentialsExpirationManager(profileName string, conf Config, mfa string) *CredentialsExpirationManager {
+	resume := profileName == "" && mfa == ""
+	if profileName == "" {
+		profileName = profileDefault
+	}
+
 	cm := &CredentialsExpirationManager{
 		role:   profileName,
 		config: conf,
 	}
+
+	if !conf.DisableSessionCache {
+		cache, err := newSessionCache()
+		if err != nil {
+			log.Printf("Session cache disabled: %v", err)
+		}
+		cm.cache = cache
+	}
+
+	if mfa == "" && cm.restoreSessions(resume) {
+		go cm.Refresher()
+		return cm
+	}
+
 	err := cm.SetSourceProfile(profileName, mfa)
 	if err != nil {
 		if isFatalError(err) {
@@ -106,6 +228,7 @@ func newTemporaryCredentialsManager(profileName string, conf Config, mfa string)
 		}
 	}
 
+	go cm.Refresher()
 	return cm
 }
 
@@ -113,84 +236,254 @@ func newTemporaryCredentialsManager(profileName string, conf Config, mfa string)
 // This operation will also update the current profile to the source profile
 func (m *CredentialsExpirationManager) SetSourceProfile(name, mfa string) error {
 	m.lock.Lock()
-	defer m.lock.Unlock()
+	m.err = nil
+	m.lock.Unlock()
 
-	fatal := false
-	checkErr := func(err error) error {
-		if fatal {
-			return makeFatal(err)
-		}
+	log.Printf("Setting base profile: %v", name)
+	s, err := m.session(name, mfa)
+	if err == errUnknownProfile && name != profileDefault {
+		err = makeFatal(err)
+	}
+
+	m.lock.Lock()
+	if err != nil {
+		m.err = err
+		m.lock.Unlock()
 		return err
 	}
-	m.err = nil
 
-	log.Printf("Setting base profile: %v", name)
+	m.credentials = s.credentials
+	m.role = name
+	m.source = s
+	m.lock.Unlock()
+
+	m.saveSessions()
+	return nil
+}
+
+/*
+session returns the session of the base profile name. The session is reused if
+it is still valid, otherwise a new session is created, which may require mfa.
+*/
+func (m *CredentialsExpirationManager) session(name, mfa string) (*sourceSession, error) {
+	m.lock.Lock()
+	s, ok := m.sessions[name]
+	generation := m.generation
+	m.lock.Unlock()
+
+	if ok && !s.expired() {
+		return s, nil
+	}
+
 	profile, ok := m.config.Profiles[name]
 	if !ok {
-		m.err = errUnknownProfile
-		if name != profileDefault {
-			return makeFatal(errUnknownProfile)
+		return nil, errUnknownProfile
+	}
+
+	log.Printf("Creating session for base profile: %v", name)
+	s, err := newSourceSession(name, profile, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	if m.generation != generation {
+		// the service was locked meanwhile, the session is not kept
+		m.lock.Unlock()
+		return s, nil
+	}
+	if m.sessions == nil {
+		m.sessions = make(map[string]*sourceSession)
+	}
+	m.sessions[name] = s
+	m.lock.Unlock()
+
+	m.saveSessions()
+	return s, nil
+}
+
+// ReloadConfig replaces the configuration, the sessions use the updated
+// profiles when they are renewed
+func (m *CredentialsExpirationManager) ReloadConfig(conf Config) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.config = conf
+	for name, s := range m.sessions {
+		if profile, ok := conf.Profiles[name]; ok {
+			s.profile = profile
+		}
+	}
+}
+
+// currentSource returns the session of the current base profile, it is
+// renewed if it has expired
+func (m *CredentialsExpirationManager) currentSource(mfa string) (*sourceSession, error) {
+	m.lock.Lock()
+	s := m.source
+	m.lock.Unlock()
+
+	if s == nil {
+		return nil, errUnknownProfile
+	}
+
+	if !s.expired() {
+		return s, nil
+	}
+
+	if err := m.SetSourceProfile(s.name, mfa); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.source, nil
+}
+
+// Sessions lists the credentials kept by the manager, sorted by kind and name
+func (m *CredentialsExpirationManager) Sessions() []SessionInfo {
+	m.lock.Lock()
+	res := []SessionInfo{}
+	if m.credentials != nil {
+		res = append(res, SessionInfo{Name: m.role, Kind: sessionActive, Expiration: *m.credentials.Expiration})
+	}
+	for name, s := range m.sessions {
+		res = append(res, SessionInfo{Name: name, Kind: sessionBase, Expiration: *s.credentials.Expiration})
+		for hop, creds := range s.hops {
+			res = append(res, SessionInfo{Name: hop, Kind: sessionChain, Expiration: *creds.Expiration})
+		}
+	}
+	m.lock.Unlock()
+
+	res = append(res, m.roles.sessions()...)
+
+	order := map[string]int{sessionActive: 0, sessionBase: 1, sessionChain: 2, sessionRole: 3, sessionRestricted: 4}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return order[res[i].Kind] < order[res[j].Kind]
+		}
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+// pruneSessions forgets sessions that have expired, except the current one
+func (m *CredentialsExpirationManager) pruneSessions() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for name, s := range m.sessions {
+		if s != m.source && s.expired() {
+			log.Printf("Session expired for base profile: %v", name)
+			delete(m.sessions, name)
+		}
+	}
+}
+
+// sourceProfileCredentials fetches the session credentials of a source profile
+func sourceProfileCredentials(name string, profile Profile, mfa string) (*sts.Credentials, error) {
+	switch {
+	case profile.webIdentity():
+		return assumeRoleWithWebIdentity(name, profile)
+	case profile.saml():
+		return assumeRoleWithSAML(name, profile)
+	case profile.sso():
+		return getSSORoleCredentials(profile)
+	default:
+		return getSessionToken(name, profile, mfa)
+	}
+}
+
+/*
+getSessionToken fetches session credentials with the long term keys of
+profile. A failure when an MFA token is given is fatal, as the token can not
+be reused.
+*/
+func getSessionToken(name string, profile Profile, mfa string) (*sts.Credentials, error) {
+	fatal := false
+
+	backend, err := profile.credentialBackend(name)
+	if err != nil {
+		return nil, err
+	}
+
+	value, expires, err := backend.Retrieve()
+	if err == errKeystoreLocked {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve credentials: %v", err)
+	}
+
+	// temporary credentials can not be used to call GetSessionToken, use them as is
+	if value.SessionToken != "" {
+		if expires.IsZero() {
+			expires = time.Now().Add(time.Hour)
 		}
-		return errUnknownProfile
+		return &sts.Credentials{
+			AccessKeyId:     aws.String(value.AccessKeyID),
+			SecretAccessKey: aws.String(value.SecretAccessKey),
+			SessionToken:    aws.String(value.SessionToken),
+			Expiration:      aws.Time(expires),
+		}, nil
 	}
 
 	sess := session.New(&aws.Config{
-		Region: &profile.Region,
-		Credentials: credentials.NewStaticCredentials(
-			profile.AwsAccessKeyID,
-			profile.AwsSecretAccessKey,
-			profile.AwsSessionToken,
-		),
+		Region:      &profile.Region,
+		Credentials: credentials.NewStaticCredentialsFromCreds(value),
 	})
+	if profile.STSEndpoint != "" {
+		sess.Config.Endpoint = aws.String(profile.STSEndpoint)
+	}
 	stsClient := sts.New(sess)
 
+	generated := false
+	if profile.MFASerial != "" && mfa == "" && profile.MFATOTPCommand != "" {
+		mfa, err = profile.totpCode()
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate MFA token: %v", err)
+		}
+		generated = true
+	}
+
 	if profile.MFASerial != "" && mfa == "" {
-		m.err = errMFANeeded
-		return errMFANeeded
+		return nil, errMFANeeded
 	}
 
 	sessionTokenInput := &sts.GetSessionTokenInput{
 		DurationSeconds: aws.Int64(10 * 3600),
 	}
+	if profile.DurationSeconds != 0 {
+		sessionTokenInput.DurationSeconds = profile.durationSeconds()
+	}
 
 	if profile.MFASerial != "" {
 		log.Println("Setting serial: ", profile.MFASerial)
 		sessionTokenInput.SerialNumber = aws.String(profile.MFASerial)
 	}
 	if mfa != "" {
-		log.Println("Setting mfa:", mfa)
 		sessionTokenInput.TokenCode = aws.String(mfa)
-		fatal = true
+		// a generated token is not fatal, a new one is generated next time
+		fatal = !generated
 	}
 
-	log.Println("Serial: ", profile.MFASerial, ", token: ", mfa)
 	sessionTokenResp, err := stsClient.GetSessionToken(sessionTokenInput)
 	if err != nil {
-		log.Println("request failed:", sessionTokenInput)
-		err = checkErr(err)
-		m.err = err
-		return err
+		log.Println("request failed:", err)
+		if fatal {
+			return nil, makeFatal(err)
+		}
+		return nil, err
 	}
 
-	m.credentials = sessionTokenResp.Credentials
-	m.sourceCredentials = sessionTokenResp.Credentials
-	m.sourceSession = session.New(&aws.Config{
-		Region: &profile.Region,
-		Credentials: credentials.NewStaticCredentials(
-			*m.credentials.AccessKeyId,
-			*m.credentials.SecretAccessKey,
-			*m.credentials.SessionToken,
-		),
-	})
-	m.role = name
-	m.sourceProfile = profile
-	m.sourceProfileName = name
-	m.sourceSTSClient = sts.New(m.sourceSession)
-	return nil
+	return sessionTokenResp.Credentials, nil
 }
 
 // Role returns the name of the current active role
 func (m *CredentialsExpirationManager) Role() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	return m.role
 }
 
@@ -204,7 +497,7 @@ func (m *CredentialsExpirationManager) Region() string {
 
 	profile, ok := m.config.Profiles[role]
 	if !ok {
-		fmt.Printf("FAiled to lookup: %v\n", role)
+		log.Printf("Failed to look up the region of %v", role)
 		return ""
 	}
 
@@ -216,6 +509,8 @@ func (m *CredentialsExpirationManager) Refresher() {
 	for {
 		select {
 		case <-time.After(10 * time.Second):
+			m.pruneSessions()
+			m.roles.prune()
 			if m.err != nil {
 				continue
 			}
@@ -227,30 +522,73 @@ func (m *CredentialsExpirationManager) Refresher() {
 // AssumeRole changes (assumes) the role `name`. An optional MFA can be passed
 // to the function, if set to "" the MFA is ignored
 func (m *CredentialsExpirationManager) AssumeRole(name, MFA string) error {
+	_, err := m.assumeRole(name, MFA, nil)
+	return err
+}
+
+/*
+assumeRole assumes the role name like AssumeRole, and returns the profile that
+was active before. If replaces is not nil the role is only switched if it
+returns true for the active profile at the time of the switch, otherwise
+errProfileChanged is returned.
+*/
+func (m *CredentialsExpirationManager) assumeRole(name, MFA string, replaces func(string) bool) (string, error) {
 	profile, ok := m.config.Profiles[name]
 	if !ok {
-		return errUnknownProfile
+		return "", errUnknownProfile
 	}
 
 	if profile.protected() {
-		return errProtectedProfile
+		return "", errProtectedProfile
 	}
 
-	log.Printf("source profile: %v, needed source profile: %v\n", m.sourceProfileName, profile.SourceProfile)
-	log.Printf("Cerentials expired: %v", m.sourceCredentialsExpired())
-	if profile.SourceProfile != m.sourceProfileName || m.sourceCredentialsExpired() {
-		err := m.SetSourceProfile(profile.SourceProfile, MFA)
-		if err != nil {
-			return err
-		}
+	chain, err := m.config.Profiles.sourceChain(name)
+	if err != nil {
+		return "", err
+	}
+
+	m.lock.Lock()
+	generation := m.generation
+	m.lock.Unlock()
+
+	// the active profile is only changed once the credentials of name are
+	// there, it never is the base profile in between
+	log.Printf("Setting base profile: %v", chain[0])
+	s, err := m.session(chain[0], MFA)
+	if err != nil {
+		return "", err
 	}
 
-	errAssume := m.AssumeRoleARN(name, profile.RoleARN, profile.MFASerial, MFA)
+	creds, errAssume := m.retrieveChain(s, chain, profile, MFA)
 	if errAssume != nil {
-		return errAssume
+		return "", errAssume
 	}
 
-	err := writeAwsConfig(profile.Region)
+	m.lock.Lock()
+	if m.generation != generation {
+		// the service was locked meanwhile
+		err := m.err
+		m.lock.Unlock()
+		if err == nil {
+			err = errLocked
+		}
+		return "", err
+	}
+	previous := m.role
+	if replaces != nil && !replaces(previous) {
+		m.lock.Unlock()
+		return "", errProfileChanged
+	}
+	m.err = nil
+	m.source = s
+	m.credentials = creds
+	m.role = name
+	m.lock.Unlock()
+
+	m.saveSessions()
+	m.mfa.done(name)
+
+	err = writeAwsConfig(profile.Region)
 	if err != nil {
 		fmt.Fprintf(errout, "error updating region: %v\n", err)
 	}
@@ -260,32 +598,69 @@ func (m *CredentialsExpirationManager) AssumeRole(name, MFA string) error {
 		fmt.Fprintf(errout, "error updating region: %v\n", err)
 	}
 
-	return nil
+	return previous, nil
 }
 
 // RetrieveRole will assume and fetch temporary credentials, but does not update
-// the role and credentials stored by the manager.
-func (m *CredentialsExpirationManager) RetrieveRole(name, MFA string) (*AwsCredentials, error) {
+// the role and credentials stored by the manager. The permissions of the
+// credentials are limited by policy, if it is not empty.
+func (m *CredentialsExpirationManager) RetrieveRole(name, MFA string, policy SessionPolicy) (*AwsCredentials, error) {
+	m.lock.Lock()
+	generation, err := m.generation, m.err
+	m.lock.Unlock()
+
+	if err == errLocked || err == errLoggedOut {
+		return nil, err
+	}
+
+	creds, err := m.roles.get(name, policy, MFA, func() (*AwsCredentials, error) {
+		return m.retrieveRole(name, MFA, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// credentials retrieved while the service was locked are dropped
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.generation != generation {
+		if m.err != nil {
+			return nil, m.err
+		}
+		return nil, errLocked
+	}
+	return creds, nil
+}
+
+// retrieveRole assumes the role name, without using the role cache
+func (m *CredentialsExpirationManager) retrieveRole(name, MFA string, policy SessionPolicy) (*AwsCredentials, error) {
 	profile, ok := m.config.Profiles[name]
 	if !ok {
 		return nil, errUnknownProfile
 	}
 
-	if profile.SourceProfile == m.sourceProfileName && !m.sourceCredentialsExpired() {
-		c, err := m.RetrieveRoleARN(profile.RoleARN, profile.MFASerial, MFA)
-		if err != nil {
-			return nil, err
+	if !policy.empty() {
+		if !profile.sessionPolicy().empty() {
+			return nil, fmt.Errorf("profile %v has a session policy, another policy can not be used with it", name)
 		}
-		return &AwsCredentials{Credentials: *c, Region: profile.Region}, nil
+		profile = profile.withSessionPolicy(policy)
+	}
+
+	chain, err := m.config.Profiles.sourceChain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain) == 1 && !profile.sessionPolicy().empty() {
+		return nil, errPolicyWithoutRole
 	}
 
-	cm := newTemporaryCredentialsManager(profileDefault, m.config, "")
-	err := cm.SetSourceProfile(profile.SourceProfile, MFA)
+	s, err := m.session(chain[0], MFA)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := cm.RetrieveRoleARN(profile.RoleARN, profile.MFASerial, MFA)
+	c, err := m.retrieveChain(s, chain, profile, MFA)
 	if err != nil {
 		return nil, err
 	}
@@ -298,35 +673,123 @@ func (m *CredentialsExpirationManager) RetrieveRoleARN(RoleARN, MFASerial, MFA s
 		return nil, m.err
 	}
 
-	if m.sourceCredentialsExpired() {
-		err := m.SetSourceProfile(m.sourceProfileName, MFA)
-		if err != nil {
+	s, err := m.currentSource(MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	// source profile is requested return sourceCredentials
+	if RoleARN == s.profile.RoleARN {
+		return s.credentials, nil
+	}
+
+	target := Profile{RoleARN: RoleARN, MFASerial: MFASerial}
+	return m.assumeRoleARN(s, s.client, "", target, MFA)
+}
+
+/*
+retrieveChain fetches temporary credentials for target, the last profile in
+chain as returned by sourceChain, using the session s of the first profile in
+the chain. The credentials of the intermediate roles are cached in the
+session, and are renewed independently of each other when they are about to
+expire.
+*/
+func (m *CredentialsExpirationManager) retrieveChain(s *sourceSession, chain []string, target Profile, MFA string) (*sts.Credentials, error) {
+	if len(chain) == 1 {
+		return s.credentials, nil
+	}
+
+	client := s.client
+	for _, name := range chain[1 : len(chain)-1] {
+		creds, err := m.hopCredentials(s, client, name, MFA)
+		if err == errMFANeeded {
 			return nil, err
 		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to assume %v: %v", name, err)
+		}
+		client = s.stsClient(creds)
 	}
 
-	// source profile is requested return sourceCredentials
-	if RoleARN == m.sourceProfile.RoleARN {
-		return m.sourceCredentials, nil
+	return m.assumeRoleARN(s, client, chain[len(chain)-1], target, MFA)
+}
+
+// hopCredentials returns the cached credentials of the intermediate role name,
+// the role is assumed with client if the credentials are missing or expiring
+func (m *CredentialsExpirationManager) hopCredentials(s *sourceSession, client *sts.STS, name, MFA string) (*sts.Credentials, error) {
+	m.lock.Lock()
+	creds, ok := s.hops[name]
+	m.lock.Unlock()
+
+	if ok && time.Now().Add(credentialsRefreshWindow).Before(*creds.Expiration) {
+		return creds, nil
+	}
+
+	log.Printf("Assuming intermediate role: %v", name)
+	profile := m.config.Profiles[name]
+	creds, err := m.assumeRoleARN(s, client, name, profile, MFA)
+	if err != nil {
+		return nil, err
 	}
 
-	if MFASerial != "" && MFA == "" {
+	m.lock.Lock()
+	s.hops[name] = creds
+	m.lock.Unlock()
+
+	m.saveSessions()
+	return creds, nil
+}
+
+/*
+assumeRoleARN assumes the role of the profile name with client, on behalf of
+the session s. The role session name is rendered from the role_session_name of
+the profile, or of the base profile if the profile has none.
+*/
+func (m *CredentialsExpirationManager) assumeRoleARN(s *sourceSession, client *sts.STS, name string, target Profile, MFA string) (*sts.Credentials, error) {
+	if target.MFASerial != "" && MFA == "" && target.MFATOTPCommand != "" {
+		code, err := target.totpCode()
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate MFA token: %v", err)
+		}
+		MFA = code
+	}
+
+	if target.MFASerial != "" && MFA == "" {
 		return nil, errMFANeeded
 	}
 
+	tmpl := target.RoleSessionName
+	if tmpl == "" {
+		tmpl = s.profile.RoleSessionName
+	}
+	sessionName, err := roleSessionName(tmpl, name, s.name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid role_session_name: %v", err)
+	}
+
 	assumeRoleInput := &sts.AssumeRoleInput{
-		RoleArn:         &RoleARN,
-		RoleSessionName: &m.sourceProfile.RoleSessionName,
+		RoleArn:         aws.String(target.RoleARN),
+		RoleSessionName: aws.String(sessionName),
+		DurationSeconds: target.durationSeconds(),
+	}
+
+	if target.ExternalID != "" {
+		assumeRoleInput.ExternalId = aws.String(target.ExternalID)
 	}
 
-	if MFASerial != "" {
-		assumeRoleInput.SerialNumber = &MFASerial
+	if target.MFASerial != "" {
+		assumeRoleInput.SerialNumber = aws.String(target.MFASerial)
 		if MFA != "" {
-			assumeRoleInput.TokenCode = &MFA
+			assumeRoleInput.TokenCode = aws.String(MFA)
 		}
 	}
 
-	resp, err := m.sourceSTSClient.AssumeRole(assumeRoleInput)
+	policy := target.sessionPolicy()
+	if policy.Policy != "" {
+		assumeRoleInput.Policy = aws.String(policy.Policy)
+	}
+
+	resp, err := assumeRole(client, assumeRoleInput, policy.policyARNs(target.RoleARN))
 	if err != nil {
 		return nil, err
 	}
@@ -354,21 +817,30 @@ func (m *CredentialsExpirationManager) AssumeRoleARN(name, RoleARN, MFASerial, M
 // with the credentials
 func (m *CredentialsExpirationManager) setCredentials(newCreds *sts.Credentials, role string) {
 	m.lock.Lock()
-	defer m.lock.Unlock()
-
 	m.credentials = newCreds
 	m.role = role
+	m.lock.Unlock()
+
+	m.saveSessions()
 }
 
 // GetCredentials returns the current saved credentials. The returned credentials
 // are copied before they are returned.
 func (m *CredentialsExpirationManager) GetCredentials() (*sts.Credentials, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if m.err != nil {
 		return nil, m.err
 	}
+	if m.credentials == nil {
+		return nil, errUnknownProfile
+	}
 
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	// the credentials are served until they expire, while waiting for an MFA token
+	if m.credentials.Expiration.Before(time.Now()) && m.mfa.isPending(m.role) {
+		return nil, errMFANeeded
+	}
 
 	return &sts.Credentials{
 		AccessKeyId:     aws.String(*m.credentials.AccessKeyId),
@@ -378,15 +850,12 @@ func (m *CredentialsExpirationManager) GetCredentials() (*sts.Credentials, error
 	}, nil
 }
 
-func (m *CredentialsExpirationManager) sourceCredentialsExpired() bool {
-	if m.sourceCredentials == nil {
-		return true
-	}
-	return m.sourceCredentials.Expiration.Before(time.Now())
-}
-
 func (m *CredentialsExpirationManager) refreshCredentials() error {
-	if m.sourceSTSClient == nil {
+	m.lock.Lock()
+	s := m.source
+	m.lock.Unlock()
+
+	if s == nil {
 		return errors.New("No STS client set for refreshing credentials")
 	}
 
@@ -395,16 +864,54 @@ func (m *CredentialsExpirationManager) refreshCredentials() error {
 		return err
 	}
 
-	if time.Now().Add(600 * time.Second).Before(*creds.Expiration) {
+	if time.Now().Add(credentialsRefreshWindow).Before(*creds.Expiration) {
 		// We no not need to refresh
 		return nil
 	}
 
-	if m.role == "" || m.role == profileDefault {
-		// Do not refresh main default role, let it time out
+	if m.mfa.isPending(m.role) {
+		// waiting for `limes mfa` or mfa_askpass
+		return errMFANeeded
+	}
+
+	if m.role == "" || (m.role == profileDefault && !s.profile.renewable() && time.Now().Before(*creds.Expiration)) {
+		// the session of the default profile can not be renewed before it expires
 		return nil
 	}
 
-	fmt.Println("====> refreshing credentials")
-	return m.AssumeRole(m.role, "")
+	log.Printf("Refreshing credentials: %v", m.role)
+	err = m.renew(m.role, "")
+	if err == errMFANeeded {
+		m.requestMFA(m.role)
+	}
+	return err
+}
+
+/*
+renew assumes role again, to renew its credentials in the background. The
+current credentials are kept if it fails, so that they are served until they
+expire. Nothing is renewed once the service has been locked or logged out.
+*/
+func (m *CredentialsExpirationManager) renew(role, mfa string) error {
+	m.renewing.Lock()
+	defer m.renewing.Unlock()
+
+	m.lock.Lock()
+	prev := m.err
+	m.lock.Unlock()
+
+	if prev == errLocked || prev == errLoggedOut {
+		return prev
+	}
+
+	err := m.AssumeRole(role, mfa)
+	if err != nil {
+		// keep an error set by anyone else since
+		m.lock.Lock()
+		if m.err == err {
+			m.err = prev
+		}
+		m.lock.Unlock()
+	}
+	return err
 }
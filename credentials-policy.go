@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// readOnlyPolicy is the managed policy attached by read_only and --read-only
+const readOnlyPolicy = "ReadOnlyAccess"
+
+// errPolicyWithoutRole is returned when a session policy is used with a base profile
+var errPolicyWithoutRole = fmt.Errorf("session policies can only be used with roles")
+
+/*
+SessionPolicy limits the permissions of a role session. The permissions of the
+session are the intersection of the permissions of the role and the session
+policies.
+*/
+type SessionPolicy struct {
+	// Policy is an inline policy document in JSON
+	Policy string
+	// PolicyARNs are managed policies
+	PolicyARNs []string
+	// ReadOnly attaches the ReadOnlyAccess managed policy
+	ReadOnly bool
+}
+
+func (p SessionPolicy) empty() bool {
+	return p.Policy == "" && len(p.PolicyARNs) == 0 && !p.ReadOnly
+}
+
+// key identifies the policy, sessions with the same key have the same permissions
+func (p SessionPolicy) key() string {
+	if p.empty() {
+		return ""
+	}
+
+	arns := append([]string{}, p.PolicyARNs...)
+	sort.Strings(arns)
+	return fmt.Sprintf("%v\x00%v\x00%v", p.Policy, strings.Join(arns, ","), p.ReadOnly)
+}
+
+// sessionPolicy returns the session policy configured for the profile
+func (p Profile) sessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		Policy:     p.Policy,
+		PolicyARNs: p.PolicyARNs,
+		ReadOnly:   p.ReadOnly,
+	}
+}
+
+// withSessionPolicy returns a copy of p using the session policy policy
+func (p Profile) withSessionPolicy(policy SessionPolicy) Profile {
+	p.Policy = policy.Policy
+	p.PolicyARNs = policy.PolicyARNs
+	p.ReadOnly = policy.ReadOnly
+	return p
+}
+
+// policyARNs returns the managed policies of the session policy, for a role
+// in the partition of roleARN
+func (p SessionPolicy) policyARNs(roleARN string) []string {
+	arns := append([]string{}, p.PolicyARNs...)
+	if p.ReadOnly {
+		partition := "aws"
+		if parts := strings.Split(roleARN, ":"); len(parts) > 1 && parts[1] != "" {
+			partition = parts[1]
+		}
+		arns = append(arns, fmt.Sprintf("arn:%v:iam::aws:policy/%v", partition, readOnlyPolicy))
+	}
+	return arns
+}
+
+// policyDescriptorType is a managed policy in an AssumeRole request
+type policyDescriptorType struct {
+	_ struct{} `type:"structure"`
+
+	Arn *string `locationName:"arn" min:"20" type:"string"`
+}
+
+/*
+assumeRoleWithPolicyInput is sts.AssumeRoleInput with the PolicyArns
+parameter, which is missing in the vendored SDK.
+*/
+type assumeRoleWithPolicyInput struct {
+	_ struct{} `type:"structure"`
+
+	DurationSeconds *int64                  `min:"900" type:"integer"`
+	ExternalId      *string                 `min:"2" type:"string"`
+	Policy          *string                 `min:"1" type:"string"`
+	PolicyArns      []*policyDescriptorType `type:"list"`
+	RoleArn         *string                 `min:"20" type:"string" required:"true"`
+	RoleSessionName *string                 `min:"2" type:"string" required:"true"`
+	SerialNumber    *string                 `min:"9" type:"string"`
+	TokenCode       *string                 `min:"6" type:"string"`
+}
+
+/*
+assumeRole calls AssumeRole with client. The request is made with PolicyArns
+when managed session policies are given.
+*/
+func assumeRole(client *sts.STS, in *sts.AssumeRoleInput, policyARNs []string) (*sts.AssumeRoleOutput, error) {
+	if len(policyARNs) == 0 {
+		return client.AssumeRole(in)
+	}
+
+	input := &assumeRoleWithPolicyInput{
+		DurationSeconds: in.DurationSeconds,
+		ExternalId:      in.ExternalId,
+		Policy:          in.Policy,
+		RoleArn:         in.RoleArn,
+		RoleSessionName: in.RoleSessionName,
+		SerialNumber:    in.SerialNumber,
+		TokenCode:       in.TokenCode,
+	}
+	for _, arn := range policyARNs {
+		input.PolicyArns = append(input.PolicyArns, &policyDescriptorType{Arn: aws.String(arn)})
+	}
+
+	output := &sts.AssumeRoleOutput{}
+	op := &request.Operation{
+		Name:       "AssumeRole",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	req := client.NewRequest(op, input, output)
+
+	return output, req.Send()
+}
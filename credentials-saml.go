@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// saml returns true if the credentials of p are fetched with a SAML assertion
+func (p Profile) saml() bool {
+	return p.SAMLRoleARN != ""
+}
+
+/*
+samlAssertions caches the last assertion of each profile, so that the command
+producing it, which often involves logging in to the identity provider, only
+is run again when the assertion has expired.
+*/
+var samlAssertions = struct {
+	sync.Mutex
+	assertions map[string]samlAssertion
+}{assertions: make(map[string]samlAssertion)}
+
+type samlAssertion struct {
+	assertion string
+	expires   time.Time
+}
+
+func (p Profile) samlAssertionKey() string {
+	return p.SAMLAssertionCommand + "\x00" + p.SAMLAssertionFile
+}
+
+/*
+samlAssertion returns the cached assertion of p, or reads a new one if it has
+expired. cached is true if the returned assertion was read earlier.
+*/
+func (p Profile) samlAssertion() (assertion string, cached bool, err error) {
+	key := p.samlAssertionKey()
+
+	samlAssertions.Lock()
+	defer samlAssertions.Unlock()
+
+	if c, ok := samlAssertions.assertions[key]; ok && time.Now().Before(c.expires) {
+		return c.assertion, true, nil
+	}
+
+	switch {
+	case p.SAMLAssertionCommand != "":
+		log.Printf("Running SAML assertion command: %v", p.SAMLAssertionCommand)
+		assertion, err = commandOutput(p.SAMLAssertionCommand)
+		if err != nil {
+			return "", false, err
+		}
+	case p.SAMLAssertionFile != "":
+		data, err := ioutil.ReadFile(p.SAMLAssertionFile)
+		if err != nil {
+			return "", false, err
+		}
+		assertion = strings.TrimSpace(string(data))
+	default:
+		return "", false, fmt.Errorf("saml_assertion_command or saml_assertion_file is required")
+	}
+
+	expires, err := samlExpiration(assertion)
+	if err != nil {
+		return "", false, err
+	}
+	samlAssertions.assertions[key] = samlAssertion{assertion: assertion, expires: expires}
+
+	return assertion, false, nil
+}
+
+// forgetSAMLAssertion removes the cached assertion of p
+func (p Profile) forgetSAMLAssertion() {
+	samlAssertions.Lock()
+	defer samlAssertions.Unlock()
+
+	delete(samlAssertions.assertions, p.samlAssertionKey())
+}
+
+/*
+samlExpiration returns the earliest NotOnOrAfter in the base64 encoded SAML
+assertion, i.e. the time the assertion no longer can be redeemed.
+*/
+func samlExpiration(assertion string) (time.Time, error) {
+	doc, err := base64.StdEncoding.DecodeString(assertion)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SAML assertion is not base64 encoded: %v", err)
+	}
+
+	var expires time.Time
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to parse SAML assertion: %v", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range element.Attr {
+			if attr.Name.Local != "NotOnOrAfter" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, attr.Value)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("unable to parse SAML assertion: %v", err)
+			}
+			if expires.IsZero() || t.Before(expires) {
+				expires = t
+			}
+		}
+	}
+
+	return expires, nil
+}
+
+// assumeRoleWithSAML assumes the SAML role of profile with an assertion from the identity provider
+func assumeRoleWithSAML(name string, profile Profile) (*sts.Credentials, error) {
+	if profile.SAMLPrincipalARN == "" {
+		return nil, fmt.Errorf("saml_principal_arn is required with saml_role_arn")
+	}
+
+	assertion, cached, err := profile.samlAssertion()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get SAML assertion: %v", err)
+	}
+
+	region := profile.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	// AssumeRoleWithSAML is not signed, the assertion is the credential
+	sess := session.New(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.AnonymousCredentials,
+	})
+
+	log.Printf("Assuming %v with SAML assertion", profile.SAMLRoleARN)
+	resp, err := sts.New(sess).AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+		RoleArn:         aws.String(profile.SAMLRoleARN),
+		PrincipalArn:    aws.String(profile.SAMLPrincipalARN),
+		SAMLAssertion:   aws.String(assertion),
+		DurationSeconds: profile.durationSeconds(),
+	})
+	if err != nil {
+		profile.forgetSAMLAssertion()
+		if cached {
+			// the identity provider might not allow the assertion to be
+			// redeemed again, retry with a new assertion
+			return assumeRoleWithSAML(name, profile)
+		}
+		return nil, err
+	}
+
+	return resp.Credentials, nil
+}
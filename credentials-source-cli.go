@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	pb "github.com/otm/limes/proto"
+)
+
+// refreshWindow is how long before expiration credentials are renewed
+const refreshWindow = 5 * time.Minute
+
+/*
+cliCredentialsSource is a CredentialsSource retrieving the credentials of a
+profile through the daemon. It is used to serve credentials to a process started
+by `limes run`, and renews the credentials when they are about to expire.
+*/
+type cliCredentialsSource struct {
+	lock    sync.Mutex
+	rpc     *cliClient
+	profile string
+	policy  *pb.SessionPolicy
+	region  string
+	creds   *sts.Credentials
+}
+
+// newCliCredentialsSource returns a cliCredentialsSource, creds are the initial credentials
+func newCliCredentialsSource(rpc *cliClient, profile string, policy *pb.SessionPolicy, creds awsEnv) (*cliCredentialsSource, error) {
+	expiration, err := parseExpiration(creds.Expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cliCredentialsSource{
+		rpc:     rpc,
+		profile: profile,
+		policy:  policy,
+		region:  creds.Region,
+		creds: &sts.Credentials{
+			AccessKeyId:     aws.String(creds.AccessKeyID),
+			SecretAccessKey: aws.String(creds.SecretAccessKey),
+			SessionToken:    aws.String(creds.SessionToken),
+			Expiration:      aws.Time(expiration),
+		},
+	}, nil
+}
+
+// GetCredentials returns the credentials of the profile, renewing them if needed
+func (s *cliCredentialsSource) GetCredentials() (*sts.Credentials, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if time.Now().Add(refreshWindow).Before(*s.creds.Expiration) {
+		return s.creds, nil
+	}
+
+	// MFA can not be asked for as the terminal belongs to the child process
+	r, err := s.rpc.srv.RetrieveRole(context.Background(), &pb.AssumeRoleRequest{Name: s.profile, Policy: s.policy})
+	if err != nil {
+		return nil, err
+	}
+
+	expiration, err := parseExpiration(r.Expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	s.creds = &sts.Credentials{
+		AccessKeyId:     aws.String(r.AccessKeyId),
+		SecretAccessKey: aws.String(r.SecretAccessKey),
+		SessionToken:    aws.String(r.SessionToken),
+		Expiration:      aws.Time(expiration),
+	}
+	return s.creds, nil
+}
+
+// Role returns the name of the profile
+func (s *cliCredentialsSource) Role() string {
+	return s.profile
+}
+
+// Region returns the region of the profile
+func (s *cliCredentialsSource) Region() string {
+	return s.region
+}
+
+/*
+startCredentialsEndpoint starts a container credentials endpoint on a random
+loop back port serving the credentials from source. The endpoint is only meant
+to be used by a single child process.
+*/
+func startCredentialsEndpoint(source CredentialsSource) (ContainerService, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(containerCredentialsHost, "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := NewContainerService(listener, source, Config{})
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return cs, cs.Start()
+}
+
+// parseExpiration parses an expiration time sent by the daemon
+func parseExpiration(expiration string) (time.Time, error) {
+	return time.Parse(time.RFC3339, expiration)
+}
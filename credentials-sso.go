@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Settings of the IAM Identity Center (AWS SSO) OIDC device authorization flow
+const (
+	ssoCacheDir          = ".limes/sso"
+	ssoClientName        = "limes"
+	ssoScope             = "sso:account:access"
+	ssoDeviceGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	ssoRefreshGrantType  = "refresh_token"
+	ssoBearerTokenHeader = "x-amz-sso_bearer_token"
+	ssoTokenMinLifetime  = time.Minute
+)
+
+// errSSOLoginNeeded is returned when there is no valid SSO access token
+var errSSOLoginNeeded = fmt.Errorf("SSO login needed")
+
+// sso returns true if the credentials of p are fetched from IAM Identity Center
+func (p Profile) sso() bool {
+	return p.SSOStartURL != ""
+}
+
+func (p Profile) ssoOIDCEndpoint() string {
+	if p.SSOOIDCEndpoint != "" {
+		return strings.TrimSuffix(p.SSOOIDCEndpoint, "/")
+	}
+	return fmt.Sprintf("https://oidc.%s.amazonaws.com", p.SSORegion)
+}
+
+func (p Profile) ssoPortalEndpoint() string {
+	if p.SSOPortalEndpoint != "" {
+		return strings.TrimSuffix(p.SSOPortalEndpoint, "/")
+	}
+	return fmt.Sprintf("https://portal.sso.%s.amazonaws.com", p.SSORegion)
+}
+
+/*
+ssoToken is the cached result of a login. The client registration is kept to
+be able to refresh the access token, and to not register a new client on
+every login.
+*/
+type ssoToken struct {
+	StartURL              string    `json:"startUrl"`
+	Region                string    `json:"region"`
+	AccessToken           string    `json:"accessToken,omitempty"`
+	ExpiresAt             time.Time `json:"expiresAt,omitempty"`
+	RefreshToken          string    `json:"refreshToken,omitempty"`
+	ClientID              string    `json:"clientId"`
+	ClientSecret          string    `json:"clientSecret"`
+	RegistrationExpiresAt time.Time `json:"registrationExpiresAt"`
+}
+
+// ssoTokenPath returns the path of the token cache for the start URL of p
+func (p Profile) ssoTokenPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(p.SSOStartURL))
+	return filepath.Join(home, ssoCacheDir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadSSOToken reads the cached token of p, a missing cache is not an error
+func loadSSOToken(p Profile) (*ssoToken, error) {
+	path, err := p.ssoTokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &ssoToken{StartURL: p.SSOStartURL, Region: p.SSORegion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &ssoToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+
+	return token, nil
+}
+
+// removeSSOTokens removes the tokens of all start URLs, a new login is needed to use them again
+func removeSSOTokens() error {
+	home, err := homeDir()
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(home, ssoCacheDir))
+}
+
+func saveSSOToken(p Profile, token *ssoToken) error {
+	path, err := p.ssoTokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// ssoError is an error response from the OIDC service
+type ssoError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	status      int
+}
+
+func (e *ssoError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%v: %v", e.Code, e.Description)
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return http.StatusText(e.status)
+}
+
+// ssoRequest sends a request to an SSO endpoint and decodes the JSON response into v
+func ssoRequest(req *http.Request, v interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := &ssoError{status: resp.StatusCode}
+		json.Unmarshal(body, e)
+		return e
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// ssoPost posts in as JSON to path of the OIDC endpoint of p
+func ssoPost(p Profile, path string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.ssoOIDCEndpoint()+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return ssoRequest(req, out)
+}
+
+// ssoRegisterClient registers limes as an OIDC client, unless the registration in token is valid
+func ssoRegisterClient(p Profile, token *ssoToken) error {
+	if token.ClientID != "" && time.Now().Add(time.Hour).Before(token.RegistrationExpiresAt) {
+		return nil
+	}
+
+	var resp struct {
+		ClientID              string `json:"clientId"`
+		ClientSecret          string `json:"clientSecret"`
+		ClientSecretExpiresAt int64  `json:"clientSecretExpiresAt"`
+	}
+	err := ssoPost(p, "/client/register", map[string]interface{}{
+		"clientName": ssoClientName,
+		"clientType": "public",
+		"scopes":     []string{ssoScope},
+	}, &resp)
+	if err != nil {
+		return fmt.Errorf("unable to register client: %v", err)
+	}
+
+	token.ClientID = resp.ClientID
+	token.ClientSecret = resp.ClientSecret
+	token.RegistrationExpiresAt = time.Unix(resp.ClientSecretExpiresAt, 0)
+	return nil
+}
+
+// ssoDeviceAuthorization is the pending authorization the user is asked to approve
+type ssoDeviceAuthorization struct {
+	DeviceCode              string `json:"deviceCode"`
+	UserCode                string `json:"userCode"`
+	VerificationURI         string `json:"verificationUri"`
+	VerificationURIComplete string `json:"verificationUriComplete"`
+	ExpiresIn               int64  `json:"expiresIn"`
+	Interval                int64  `json:"interval"`
+}
+
+// ssoStartLogin registers the client if needed and starts a device authorization
+func ssoStartLogin(p Profile) (*ssoToken, *ssoDeviceAuthorization, error) {
+	token, err := loadSSOToken(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ssoRegisterClient(p, token); err != nil {
+		return nil, nil, err
+	}
+
+	auth := &ssoDeviceAuthorization{}
+	err = ssoPost(p, "/device_authorization", map[string]string{
+		"clientId":     token.ClientID,
+		"clientSecret": token.ClientSecret,
+		"startUrl":     p.SSOStartURL,
+	}, auth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to start device authorization: %v", err)
+	}
+
+	return token, auth, nil
+}
+
+// ssoTokenResponse is the response from the OIDC token endpoint
+type ssoTokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (r ssoTokenResponse) update(token *ssoToken) {
+	token.AccessToken = r.AccessToken
+	token.ExpiresAt = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	if r.RefreshToken != "" {
+		token.RefreshToken = r.RefreshToken
+	}
+}
+
+/*
+ssoWaitLogin polls the token endpoint until the user has approved the device
+authorization, and stores the token in the cache.
+*/
+func ssoWaitLogin(p Profile, token *ssoToken, auth *ssoDeviceAuthorization) error {
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var resp ssoTokenResponse
+		err := ssoPost(p, "/token", map[string]string{
+			"clientId":     token.ClientID,
+			"clientSecret": token.ClientSecret,
+			"grantType":    ssoDeviceGrantType,
+			"deviceCode":   auth.DeviceCode,
+		}, &resp)
+		if e, ok := err.(*ssoError); ok {
+			switch e.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("login failed: %v", err)
+		}
+
+		resp.update(token)
+		return saveSSOToken(p, token)
+	}
+
+	return fmt.Errorf("login failed: device authorization expired")
+}
+
+// ssoRefresh renews the access token with the refresh token
+func ssoRefresh(p Profile, token *ssoToken) error {
+	var resp ssoTokenResponse
+	err := ssoPost(p, "/token", map[string]string{
+		"clientId":     token.ClientID,
+		"clientSecret": token.ClientSecret,
+		"grantType":    ssoRefreshGrantType,
+		"refreshToken": token.RefreshToken,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	resp.update(token)
+	return saveSSOToken(p, token)
+}
+
+// ssoAccessToken returns a valid access token, refreshing it if needed
+func ssoAccessToken(p Profile) (string, error) {
+	token, err := loadSSOToken(p)
+	if err != nil {
+		return "", err
+	}
+
+	if token.AccessToken != "" && time.Now().Add(ssoTokenMinLifetime).Before(token.ExpiresAt) {
+		return token.AccessToken, nil
+	}
+
+	if token.RefreshToken == "" {
+		return "", errSSOLoginNeeded
+	}
+
+	log.Printf("Refreshing SSO access token for %v", p.SSOStartURL)
+	if err := ssoRefresh(p, token); err != nil {
+		log.Printf("Unable to refresh SSO access token: %v", err)
+		return "", errSSOLoginNeeded
+	}
+
+	return token.AccessToken, nil
+}
+
+/*
+getSSORoleCredentials fetches credentials for the account and role of profile
+from the IAM Identity Center portal.
+*/
+func getSSORoleCredentials(profile Profile) (*sts.Credentials, error) {
+	if profile.SSOAccountID == "" || profile.SSORoleName == "" || profile.SSORegion == "" {
+		return nil, fmt.Errorf("sso_region, sso_account_id and sso_role_name are required with sso_start_url")
+	}
+
+	accessToken, err := ssoAccessToken(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("account_id", profile.SSOAccountID)
+	query.Set("role_name", profile.SSORoleName)
+	req, err := http.NewRequest(http.MethodGet, profile.ssoPortalEndpoint()+"/federation/credentials?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(ssoBearerTokenHeader, accessToken)
+
+	var resp struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+	log.Printf("Fetching SSO credentials for %v in %v", profile.SSORoleName, profile.SSOAccountID)
+	err = ssoRequest(req, &resp)
+	if e, ok := err.(*ssoError); ok && e.status == http.StatusUnauthorized {
+		return nil, errSSOLoginNeeded
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds := resp.RoleCredentials
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(creds.AccessKeyID),
+		SecretAccessKey: aws.String(creds.SecretAccessKey),
+		SessionToken:    aws.String(creds.SessionToken),
+		Expiration:      aws.Time(time.Unix(0, creds.Expiration*int64(time.Millisecond))),
+	}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// webIdentity returns true if the credentials of p are fetched with a web identity token
+func (p Profile) webIdentity() bool {
+	return p.WebIdentityTokenFile != "" || p.WebIdentityTokenCommand != ""
+}
+
+// webIdentityToken reads the token from the token file, or runs the token command
+func (p Profile) webIdentityToken() (string, error) {
+	if p.WebIdentityTokenCommand != "" {
+		return commandOutput(p.WebIdentityTokenCommand)
+	}
+
+	token, err := ioutil.ReadFile(p.WebIdentityTokenFile)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
+
+/*
+assumeRoleWithWebIdentity assumes the role of profile with a web identity
+token, e.g. an OIDC token from a CI system. The token is read every time as
+the tokens are short lived and renewed by the issuer.
+*/
+func assumeRoleWithWebIdentity(name string, profile Profile) (*sts.Credentials, error) {
+	if profile.RoleARN == "" {
+		return nil, fmt.Errorf("role_arn is required with web identity tokens")
+	}
+
+	token, err := profile.webIdentityToken()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read web identity token: %v", err)
+	}
+
+	sessionName, err := roleSessionName(profile.RoleSessionName, name, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid role_session_name: %v", err)
+	}
+
+	region := profile.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	// AssumeRoleWithWebIdentity is not signed, the token is the credential
+	sess := session.New(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.AnonymousCredentials,
+	})
+
+	log.Printf("Assuming %v with web identity token", profile.RoleARN)
+	resp, err := sts.New(sess).AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(profile.RoleARN),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(token),
+		DurationSeconds:  profile.durationSeconds(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Credentials, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats of `limes env` that are not shells
+const (
+	envFormatDefault        = "bash"
+	formatCredentialProcess = "credential_process"
+)
+
+// envVars are all variables set by `limes env`, these are unset with --clear
+var envVars = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_DEFAULT_REGION",
+	"AWS_REGION",
+	containerCredentialsURIEnv,
+	containerAuthorizationEnv,
+}
+
+// envVar is an environment variable
+type envVar struct {
+	Name  string
+	Value string
+}
+
+/*
+envFormat defines how variables are set and unset in a shell. Formats that can
+not unset variables have a nil unset function.
+*/
+type envFormat struct {
+	set   func(w io.Writer, vars []envVar) error
+	unset func(w io.Writer, names []string)
+	usage string
+}
+
+var envFormats = map[string]envFormat{
+	"bash":       shellFormat,
+	"zsh":        shellFormat,
+	"sh":         shellFormat,
+	"fish":       fishFormat,
+	"powershell": powershellFormat,
+	"dotenv":     dotenvFormat,
+	"json":       jsonFormat,
+}
+
+// envFormatNames returns the names of the supported formats
+func envFormatNames() []string {
+	names := []string{formatCredentialProcess}
+	for name := range envFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var shellFormat = envFormat{
+	set: func(w io.Writer, vars []envVar) error {
+		for _, v := range vars {
+			fmt.Fprintf(w, "export %v=%v\n", v.Name, quoteShell(v.Value))
+		}
+		return nil
+	},
+	unset: func(w io.Writer, names []string) {
+		fmt.Fprintf(w, "unset %v\n", strings.Join(names, " "))
+	},
+	usage: `eval "$(%v)"`,
+}
+
+var fishFormat = envFormat{
+	set: func(w io.Writer, vars []envVar) error {
+		for _, v := range vars {
+			fmt.Fprintf(w, "set -gx %v %v;\n", v.Name, quoteFish(v.Value))
+		}
+		return nil
+	},
+	unset: func(w io.Writer, names []string) {
+		fmt.Fprintf(w, "set -e %v;\n", strings.Join(names, " "))
+	},
+	usage: "%v | source",
+}
+
+var powershellFormat = envFormat{
+	set: func(w io.Writer, vars []envVar) error {
+		for _, v := range vars {
+			fmt.Fprintf(w, "$Env:%v = %v\n", v.Name, quotePowershell(v.Value))
+		}
+		return nil
+	},
+	unset: func(w io.Writer, names []string) {
+		for _, name := range names {
+			fmt.Fprintf(w, "Remove-Item Env:\\%v -ErrorAction SilentlyContinue\n", name)
+		}
+	},
+	usage: "%v | Invoke-Expression",
+}
+
+var dotenvFormat = envFormat{
+	set: func(w io.Writer, vars []envVar) error {
+		for _, v := range vars {
+			value := v.Value
+			if strings.ContainsAny(value, " \t\"'#$\\\n") {
+				value = strconv.Quote(value)
+			}
+			fmt.Fprintf(w, "%v=%v\n", v.Name, value)
+		}
+		return nil
+	},
+}
+
+var jsonFormat = envFormat{
+	set: func(w io.Writer, vars []envVar) error {
+		m := make(map[string]string, len(vars))
+		for _, v := range vars {
+			m[v.Name] = v.Value
+		}
+		return writeJSON(w, m)
+	},
+}
+
+/*
+writeCredentialProcess writes creds in the JSON format expected from a program
+configured with credential_process in the AWS configuration.
+*/
+func writeCredentialProcess(w io.Writer, creds awsEnv) error {
+	expiration, err := parseExpiration(creds.Expiration)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, &credentialProcessResponse{
+		Version:         1,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// shellSafe returns true if s can be used unquoted in a shell
+func shellSafe(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=/.,:@%", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteShell(s string) string {
+	if shellSafe(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func quoteFish(s string) string {
+	if shellSafe(s) {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+func quotePowershell(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+/*
+Structure encoded as JSON for credential_process.
+*/
+type credentialProcessResponse struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+)
+
+// Settings of the IAM API, which is a global service signed for us-east-1
+const (
+	iamServiceName     = "iam"
+	iamAPIVersion      = "2010-05-08"
+	iamSigningRegion   = "us-east-1"
+	iamDefaultEndpoint = "https://iam.amazonaws.com"
+)
+
+/*
+iamClient is a minimal client for the IAM query API, covering the access key
+operations needed to rotate keys.
+*/
+type iamClient struct {
+	*client.Client
+}
+
+// newIAMClient returns a client using creds, endpoint defaults to the global IAM endpoint
+func newIAMClient(creds *credentials.Credentials, endpoint string) *iamClient {
+	if endpoint == "" {
+		endpoint = iamDefaultEndpoint
+	}
+
+	sess := session.New(&aws.Config{
+		Credentials: creds,
+		Region:      aws.String(iamSigningRegion),
+	})
+
+	c := client.New(
+		*sess.Config,
+		metadata.ClientInfo{
+			ServiceName:   iamServiceName,
+			SigningRegion: iamSigningRegion,
+			Endpoint:      endpoint,
+			APIVersion:    iamAPIVersion,
+		},
+		sess.Handlers,
+	)
+	c.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	c.Handlers.Build.PushBackNamed(query.BuildHandler)
+	c.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	c.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	c.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+
+	return &iamClient{c}
+}
+
+func (c *iamClient) send(operation string, input, output interface{}) error {
+	req := c.NewRequest(&request.Operation{
+		Name:       operation,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output)
+	return req.Send()
+}
+
+type iamAccessKey struct {
+	_ struct{} `type:"structure"`
+
+	AccessKeyId     *string `type:"string"`
+	SecretAccessKey *string `type:"string"`
+	Status          *string `type:"string"`
+	UserName        *string `type:"string"`
+}
+
+type iamCreateAccessKeyInput struct {
+	_ struct{} `type:"structure"`
+}
+
+type iamCreateAccessKeyOutput struct {
+	_ struct{} `type:"structure"`
+
+	AccessKey *iamAccessKey `type:"structure"`
+}
+
+type iamUpdateAccessKeyInput struct {
+	_ struct{} `type:"structure"`
+
+	AccessKeyId *string `type:"string"`
+	Status      *string `type:"string"`
+}
+
+type iamDeleteAccessKeyInput struct {
+	_ struct{} `type:"structure"`
+
+	AccessKeyId *string `type:"string"`
+}
+
+type iamEmptyOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// CreateAccessKey creates a new access key for the calling user
+func (c *iamClient) CreateAccessKey() (*iamAccessKey, error) {
+	output := &iamCreateAccessKeyOutput{}
+	err := c.send("CreateAccessKey", &iamCreateAccessKeyInput{}, output)
+	if err != nil {
+		return nil, err
+	}
+	return output.AccessKey, nil
+}
+
+// DeactivateAccessKey sets the status of the access key of the calling user to inactive
+func (c *iamClient) DeactivateAccessKey(accessKeyID string) error {
+	return c.send("UpdateAccessKey", &iamUpdateAccessKeyInput{
+		AccessKeyId: aws.String(accessKeyID),
+		Status:      aws.String("Inactive"),
+	}, &iamEmptyOutput{})
+}
+
+// DeleteAccessKey deletes the access key of the calling user
+func (c *iamClient) DeleteAccessKey(accessKeyID string) error {
+	return c.send("DeleteAccessKey", &iamDeleteAccessKeyInput{
+		AccessKeyId: aws.String(accessKeyID),
+	}, &iamEmptyOutput{})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+)
+
+// Object identifiers used when encoding PKCS7 signatures
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+/*
+instanceIdentity holds the key and certificate used to sign the instance
+identity document. It is generated on first start and stored on disk so that
+the certificate stays valid between restarts.
+*/
+type instanceIdentity struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+/*
+loadInstanceIdentity reads the identity key and certificate from path. If the
+file does not exist a new key and self signed certificate is generated and
+written to path.
+*/
+func loadInstanceIdentity(path string) (*instanceIdentity, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createInstanceIdentity(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := &instanceIdentity{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			id.key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "CERTIFICATE":
+			id.cert, err = x509.ParseCertificate(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+		}
+	}
+
+	if id.key == nil || id.cert == nil {
+		return nil, fmt.Errorf("unable to parse %v: key or certificate missing", path)
+	}
+
+	return id, nil
+}
+
+func createInstanceIdentity(path string) (*instanceIdentity, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"limes"},
+			CommonName:   "limes instance identity",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	id := &instanceIdentity{
+		key:  key,
+		cert: cert,
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	data = append(data, id.certificatePEM()...)
+
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// certificatePEM returns the PEM encoded certificate used to verify signatures
+func (id *instanceIdentity) certificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: id.cert.Raw,
+	})
+}
+
+// sign returns the SHA256 RSA signature of document
+func (id *instanceIdentity) sign(document []byte) ([]byte, error) {
+	digest := sha256.Sum256(document)
+	return rsa.SignPKCS1v15(rand.Reader, id.key, crypto.SHA256, digest[:])
+}
+
+/*
+signPKCS7 returns a DER encoded, detached, PKCS7 signature of document. The
+signature can be verified with:
+
+	openssl smime -verify -in pkcs7.pem -inform PEM -content document -certfile cert.pem -noverify
+*/
+func (id *instanceIdentity) signPKCS7(document []byte) ([]byte, error) {
+	signature, err := id.sign(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return id.pkcs7(signerInfo(id.cert, asn1.RawValue{}, signature), false)
+}
+
+/*
+signRSA2048 returns a DER encoded, detached, PKCS7 signature of document like
+the rsa2048 signature of EC2: the content type, the digest of document and
+the signing time are signed with RSA-2048 and SHA-256, and the certificate is
+included, so it verifies without -certfile.
+*/
+func (id *instanceIdentity) signRSA2048(document []byte) ([]byte, error) {
+	digest := sha256.Sum256(document)
+	attributes, err := pkcs7Attributes(
+		pkcs7Attribute{Type: oidContentType, Value: oidData},
+		pkcs7Attribute{Type: oidMessageDigest, Value: digest[:]},
+		pkcs7Attribute{Type: oidSigningTime, Value: time.Now().UTC()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the attributes are signed as a SET, and embedded with the implicit tag [0]
+	signature, err := id.sign(attributes)
+	if err != nil {
+		return nil, err
+	}
+	implicit := asn1.RawValue{FullBytes: append([]byte{0xa0}, attributes[1:]...)}
+
+	return id.pkcs7(signerInfo(id.cert, implicit, signature), true)
+}
+
+// signerInfo returns the PKCS7 signer of cert for a SHA-256 RSA signature
+func signerInfo(cert *x509.Certificate, attributes asn1.RawValue, signature []byte) pkcs7SignerInfo {
+	return pkcs7SignerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		},
+		DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+		AuthenticatedAttributes:   attributes,
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+		EncryptedDigest:           signature,
+	}
+}
+
+// pkcs7 returns the DER encoded signed data of signer, with the certificate if withCert is true
+func (id *instanceIdentity) pkcs7(signer pkcs7SignerInfo, withCert bool) ([]byte, error) {
+	signedData := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{signer.DigestAlgorithm},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidData},
+		SignerInfos:      []pkcs7SignerInfo{signer},
+	}
+	if withCert {
+		signedData.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: id.cert.Raw}
+	}
+
+	content, err := asn1.Marshal(signedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      content,
+		},
+	})
+}
+
+// pkcs7Attribute is a signed attribute with a single value
+type pkcs7Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// pkcs7Attributes returns the DER encoded SET OF attrs, sorted as DER requires
+func pkcs7Attributes(attrs ...pkcs7Attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, attr := range attrs {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}{attr.Type, []asn1.RawValue{{FullBytes: value}}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, der)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// New access keys take a while before they can be used
+const (
+	rotateVerifyTimeout  = 60 * time.Second
+	rotateVerifyInterval = 2 * time.Second
+)
+
+// rotationSTSClient returns an STS client for creds, using the region and endpoint of profile
+func rotationSTSClient(profile Profile, creds credentials.Value) *sts.STS {
+	region := profile.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	cfg := &aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentialsFromCreds(creds),
+	}
+	if profile.STSEndpoint != "" {
+		cfg.Endpoint = aws.String(profile.STSEndpoint)
+	}
+
+	return sts.New(session.New(cfg))
+}
+
+/*
+rotateAccessKey replaces the access key old of profile. A new key is created
+and verified to belong to the same user, before it is stored with save. The
+old key is deactivated and deleted once the new key is stored, so that the
+user never is left without a working key. If the profile has an MFA serial the
+IAM calls are made with a session authenticated with mfa.
+*/
+func rotateAccessKey(profile Profile, old credentials.Value, mfa string, save func(credentials.Value) error) (credentials.Value, error) {
+	identity, err := rotationSTSClient(profile, old).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("unable to verify current key: %v", err)
+	}
+
+	iamCreds := credentials.NewStaticCredentialsFromCreds(old)
+	if profile.MFASerial != "" {
+		resp, err := rotationSTSClient(profile, old).GetSessionToken(&sts.GetSessionTokenInput{
+			SerialNumber: aws.String(profile.MFASerial),
+			TokenCode:    aws.String(mfa),
+		})
+		if err != nil {
+			return credentials.Value{}, err
+		}
+		iamCreds = credentials.NewStaticCredentials(
+			*resp.Credentials.AccessKeyId,
+			*resp.Credentials.SecretAccessKey,
+			*resp.Credentials.SessionToken,
+		)
+	}
+	iam := newIAMClient(iamCreds, profile.IAMEndpoint)
+
+	key, err := iam.CreateAccessKey()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("unable to create access key: %v", err)
+	}
+	created := credentials.Value{
+		AccessKeyID:     aws.StringValue(key.AccessKeyId),
+		SecretAccessKey: aws.StringValue(key.SecretAccessKey),
+	}
+	log.Printf("Created access key: %v", created.AccessKeyID)
+
+	// discard the new key if it can not be used
+	abort := func(err error) (credentials.Value, error) {
+		if errDelete := iam.DeleteAccessKey(created.AccessKeyID); errDelete != nil {
+			return credentials.Value{}, fmt.Errorf("%v, and unable to delete the new key %v: %v", err, created.AccessKeyID, errDelete)
+		}
+		return credentials.Value{}, err
+	}
+
+	if err := verifyAccessKey(profile, created, aws.StringValue(identity.Arn)); err != nil {
+		return abort(err)
+	}
+
+	if err := save(created); err != nil {
+		return abort(fmt.Errorf("unable to store the new key: %v", err))
+	}
+
+	if err := iam.DeactivateAccessKey(old.AccessKeyID); err != nil {
+		return created, fmt.Errorf("new key stored, but unable to deactivate the old key %v: %v", old.AccessKeyID, err)
+	}
+
+	if err := iam.DeleteAccessKey(old.AccessKeyID); err != nil {
+		return created, fmt.Errorf("new key stored, but unable to delete the old key %v: %v", old.AccessKeyID, err)
+	}
+
+	return created, nil
+}
+
+// verifyAccessKey waits until the key can be used, and checks that it belongs to arn
+func verifyAccessKey(profile Profile, key credentials.Value, arn string) error {
+	client := rotationSTSClient(profile, key)
+
+	deadline := time.Now().Add(rotateVerifyTimeout)
+	for {
+		identity, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err == nil {
+			if aws.StringValue(identity.Arn) != arn {
+				return fmt.Errorf("new key belongs to %v, expected %v", aws.StringValue(identity.Arn), arn)
+			}
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("unable to verify new key: %v", err)
+		}
+		log.Printf("Waiting for new key: %v", err)
+		time.Sleep(rotateVerifyInterval)
+	}
+}
+
+// backupFile copies path to path.bak
+func backupFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+".bak", data, 0600)
+}
+
+/*
+replaceKeyInConfig replaces the access key old with key in the configuration
+file at path. The file is edited as text to keep comments and formatting, a
+backup of the file is kept in path.bak.
+*/
+func replaceKeyInConfig(path string, old, key credentials.Value) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	conf := string(data)
+	if strings.Count(conf, old.AccessKeyID) != 1 || strings.Count(conf, old.SecretAccessKey) != 1 {
+		return fmt.Errorf("the key %v is not defined exactly once in %v", old.AccessKeyID, path)
+	}
+
+	conf = strings.Replace(conf, old.AccessKeyID, key.AccessKeyID, 1)
+	conf = strings.Replace(conf, old.SecretAccessKey, key.SecretAccessKey, 1)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := backupFile(path); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(conf), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+/*
+fakeIAM is an STS and IAM endpoint for the access key operations used by
+rotateAccessKey. Requests are authenticated by the access key in the
+signature, and keys created with CreateAccessKey belong to user.
+*/
+type fakeIAM struct {
+	lock    sync.Mutex
+	user    string
+	keys    map[string]string
+	created int
+	calls   []string
+}
+
+func newFakeIAM(user string, keys map[string]string) *fakeIAM {
+	return &fakeIAM{user: user, keys: keys}
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keyID := ""
+	if auth := r.Header.Get("Authorization"); strings.Contains(auth, "Credential=") {
+		keyID = strings.SplitN(strings.SplitN(auth, "Credential=", 2)[1], "/", 2)[0]
+	}
+
+	action := r.Form.Get("Action")
+	f.calls = append(f.calls, action+" "+keyID)
+
+	if _, ok := f.keys[keyID]; !ok {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Code>InvalidClientTokenId</Code><Message>invalid key</Message></Error></ErrorResponse>`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch action {
+	case "GetCallerIdentity":
+		fmt.Fprintf(w, `<GetCallerIdentityResponse><GetCallerIdentityResult><Arn>%v</Arn><UserId>U</UserId><Account>123456789012</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`, f.user)
+	case "CreateAccessKey":
+		f.created++
+		id := fmt.Sprintf("AKIANEW%d", f.created)
+		f.keys[id] = "newsecret"
+		fmt.Fprintf(w, `<CreateAccessKeyResponse><CreateAccessKeyResult><AccessKey><UserName>me</UserName><AccessKeyId>%v</AccessKeyId><Status>Active</Status><SecretAccessKey>newsecret</SecretAccessKey></AccessKey></CreateAccessKeyResult></CreateAccessKeyResponse>`, id)
+	case "UpdateAccessKey":
+		fmt.Fprint(w, `<UpdateAccessKeyResponse></UpdateAccessKeyResponse>`)
+	case "DeleteAccessKey":
+		delete(f.keys, r.Form.Get("AccessKeyId"))
+		fmt.Fprint(w, `<DeleteAccessKeyResponse></DeleteAccessKeyResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Code>InvalidAction</Code><Message>%v</Message></Error></ErrorResponse>`, action)
+	}
+}
+
+func (f *fakeIAM) hasKey(id string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, ok := f.keys[id]
+	return ok
+}
+
+func (f *fakeIAM) called(call string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, c := range f.calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRotateAccessKey(t *testing.T) {
+	fake := newFakeIAM("arn:aws:iam::123456789012:user/me", map[string]string{"AKIAOLD": "oldsecret"})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	profile := Profile{Region: "eu-west-1", IAMEndpoint: srv.URL, STSEndpoint: srv.URL}
+	old := credentials.Value{AccessKeyID: "AKIAOLD", SecretAccessKey: "oldsecret"}
+
+	var saved credentials.Value
+	created, err := rotateAccessKey(profile, old, "", func(key credentials.Value) error {
+		saved = key
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("rotateAccessKey: %v", err)
+	}
+
+	if created.AccessKeyID != "AKIANEW1" || created.SecretAccessKey != "newsecret" {
+		t.Errorf("created key = %v, want AKIANEW1", created.AccessKeyID)
+	}
+	if saved != created {
+		t.Errorf("saved key = %v, want %v", saved.AccessKeyID, created.AccessKeyID)
+	}
+	if !fake.called("GetCallerIdentity AKIANEW1") {
+		t.Errorf("the new key was not verified")
+	}
+	if !fake.called("UpdateAccessKey AKIAOLD") {
+		t.Errorf("the old key was not deactivated")
+	}
+	if fake.hasKey("AKIAOLD") {
+		t.Errorf("the old key was not deleted")
+	}
+	if !fake.hasKey("AKIANEW1") {
+		t.Errorf("the new key was deleted")
+	}
+}
+
+func TestRotateAccessKeySaveFails(t *testing.T) {
+	fake := newFakeIAM("arn:aws:iam::123456789012:user/me", map[string]string{"AKIAOLD": "oldsecret"})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	profile := Profile{Region: "eu-west-1", IAMEndpoint: srv.URL, STSEndpoint: srv.URL}
+	old := credentials.Value{AccessKeyID: "AKIAOLD", SecretAccessKey: "oldsecret"}
+
+	_, err := rotateAccessKey(profile, old, "", func(key credentials.Value) error {
+		return fmt.Errorf("disk full")
+	})
+	if err == nil {
+		t.Fatalf("rotateAccessKey succeeded, want an error")
+	}
+
+	if !fake.hasKey("AKIAOLD") {
+		t.Errorf("the old key was deleted")
+	}
+	if fake.hasKey("AKIANEW1") {
+		t.Errorf("the new key was not discarded")
+	}
+}
+
+func TestRotateAccessKeyInvalidKey(t *testing.T) {
+	fake := newFakeIAM("arn:aws:iam::123456789012:user/me", map[string]string{})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	profile := Profile{Region: "eu-west-1", IAMEndpoint: srv.URL, STSEndpoint: srv.URL}
+	old := credentials.Value{AccessKeyID: "AKIAOLD", SecretAccessKey: "oldsecret"}
+
+	_, err := rotateAccessKey(profile, old, "", func(key credentials.Value) error {
+		t.Errorf("the key was saved")
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("rotateAccessKey succeeded, want an error")
+	}
+
+	if fake.called("CreateAccessKey AKIAOLD") {
+		t.Errorf("a key was created with an invalid key")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Settings of the encrypted keystore
+const (
+	keystoreFilePath    = ".limes/keystore"
+	keystoreVersion     = 1
+	keystoreKDF         = "pbkdf2-sha256"
+	keystoreIterations  = 600000
+	keystoreSaltSize    = 16
+	keystoreKeySize     = 32
+	keystoreAdditional  = "limes keystore v1"
+	credentialSourceKey = "keystore"
+)
+
+// Common errors for the keystore
+var (
+	errKeystoreLocked     = fmt.Errorf("Keystore locked")
+	errKeystoreMissing    = fmt.Errorf("Keystore does not exist")
+	errKeystorePassphrase = fmt.Errorf("incorrect passphrase")
+)
+
+// storedKey is an access key pair stored in the keystore
+type storedKey struct {
+	AccessKeyID     string `json:"aws_access_key_id"`
+	SecretAccessKey string `json:"aws_secret_access_key"`
+}
+
+/*
+keystoreFile is the on disk format of the keystore. The keys are encrypted
+with AES-256-GCM, using a key derived from the passphrase.
+*/
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// keystorePath returns the path of the keystore file
+func keystorePath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, keystoreFilePath), nil
+}
+
+func keystoreCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, keystoreKeySize, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// readKeystore decrypts the keystore at path with passphrase
+func readKeystore(path, passphrase string) (map[string]storedKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errKeystoreMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := keystoreFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+
+	if file.Version != keystoreVersion || file.KDF != keystoreKDF {
+		return nil, fmt.Errorf("unsupported keystore: version %v, %v", file.Version, file.KDF)
+	}
+
+	aead, err := keystoreCipher(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, file.Nonce, file.Data, []byte(keystoreAdditional))
+	if err != nil {
+		return nil, errKeystorePassphrase
+	}
+
+	keys := make(map[string]storedKey)
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+
+	return keys, nil
+}
+
+/*
+writeKeystore encrypts keys with passphrase and writes them to path. A new
+salt is used every time the keystore is written.
+*/
+func writeKeystore(path, passphrase string, keys map[string]storedKey) error {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	file := keystoreFile{
+		Version:    keystoreVersion,
+		KDF:        keystoreKDF,
+		Iterations: keystoreIterations,
+		Salt:       make([]byte, keystoreSaltSize),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+
+	aead, err := keystoreCipher(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, []byte(keystoreAdditional))
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+/*
+unlockedKeys holds the keys of the keystore in the service once it has been
+unlocked. The keys are only kept in memory.
+*/
+var unlockedKeys = struct {
+	sync.Mutex
+	keys map[string]storedKey
+}{}
+
+// unlockKeystore decrypts the keystore and keeps the keys in memory
+func unlockKeystore(passphrase string) error {
+	path, err := keystorePath()
+	if err != nil {
+		return err
+	}
+
+	keys, err := readKeystore(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	unlockedKeys.Lock()
+	defer unlockedKeys.Unlock()
+	unlockedKeys.keys = keys
+
+	return nil
+}
+
+// lockKeystore forgets the keys of the keystore, until it is unlocked again
+func lockKeystore() {
+	unlockedKeys.Lock()
+	defer unlockedKeys.Unlock()
+	unlockedKeys.keys = nil
+}
+
+// keystoreBackend provides the keys stored for a profile in the unlocked keystore
+type keystoreBackend struct {
+	name string
+}
+
+func (b *keystoreBackend) Retrieve() (credentials.Value, time.Time, error) {
+	unlockedKeys.Lock()
+	defer unlockedKeys.Unlock()
+
+	if unlockedKeys.keys == nil {
+		return credentials.Value{}, time.Time{}, errKeystoreLocked
+	}
+
+	key, ok := unlockedKeys.keys[b.name]
+	if !ok {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("no keys stored for %v, run 'limes keys add %v'", b.name, b.name)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     key.AccessKeyID,
+		SecretAccessKey: key.SecretAccessKey,
+	}, time.Time{}, nil
+}
+
+// usesKeystore returns true if any profile reads its keys from the keystore
+func (p Profiles) usesKeystore() bool {
+	for _, profile := range p {
+		if profile.CredentialSource == credentialSourceKey {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	registerCredentialBackend(credentialSourceKey, func(name string, p Profile) (CredentialBackend, error) {
+		return &keystoreBackend{name: name}, nil
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// idleCheckInterval is how often the service checks if it has been idle for too long
+var idleCheckInterval = 10 * time.Second
+
+// Errors returned after the service has been locked or logged out, until a
+// profile is assumed again
+var (
+	errLocked    = fmt.Errorf("Locked")
+	errLoggedOut = fmt.Errorf("Logged out")
+)
+
+// activity is the time of the last request to the metadata service, the
+// container credentials service or from the cli
+var activity = struct {
+	sync.Mutex
+	last time.Time
+}{last: time.Now()}
+
+// touchActivity records a request to the service
+func touchActivity() {
+	activity.Lock()
+	defer activity.Unlock()
+	activity.last = time.Now()
+}
+
+// lastActivity returns the time of the last request to the service
+func lastActivity() time.Time {
+	activity.Lock()
+	defer activity.Unlock()
+	return activity.last
+}
+
+// trackActivity records every request to handler as activity
+func trackActivity(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		touchActivity()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// grpcActivity returns the server options that record every cli call as activity
+func grpcActivity() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryActivity),
+		grpc.StreamInterceptor(streamActivity),
+	}
+}
+
+// unaryActivity records a unary cli call as activity
+func unaryActivity(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	touchActivity()
+	return handler(ctx, req)
+}
+
+// streamActivity records a streaming cli call as activity
+func streamActivity(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	touchActivity()
+	return handler(srv, ss)
+}
+
+/*
+lockWhenIdle calls lock when there has been no activity for timeout. It is
+called once per idle period, the service is not locked again until it has
+been used.
+*/
+func lockWhenIdle(timeout time.Duration, lock func()) {
+	var locked time.Time
+	for range time.Tick(idleCheckInterval) {
+		last := lastActivity()
+		if last.Before(locked) || time.Since(last) < timeout {
+			continue
+		}
+
+		lock()
+		locked = time.Now()
+	}
+}
+
+/*
+forget makes the manager forget all credentials and remove the session cache.
+Credentials are not served again, and reason is returned, until a profile is
+assumed.
+*/
+func (m *CredentialsExpirationManager) forget(reason error) error {
+	m.renewing.Lock()
+	defer m.renewing.Unlock()
+
+	m.lock.Lock()
+	m.generation++
+	m.err = reason
+	m.source = nil
+	m.sessions = nil
+	m.credentials = nil
+	m.lock.Unlock()
+
+	m.roles.forget()
+	m.mfa.forget()
+	m.stack.timebox(0, nil)
+
+	if m.cache == nil {
+		return nil
+	}
+	return m.cache.remove()
+}
+
+// Lock forgets all credentials, the active profile is kept
+func (m *CredentialsExpirationManager) Lock() error {
+	return m.forget(errLocked)
+}
+
+// Logout forgets all credentials and the active profile
+func (m *CredentialsExpirationManager) Logout() error {
+	err := m.forget(errLoggedOut)
+	m.stack.forget()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.role = ""
+
+	return err
+}
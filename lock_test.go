@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"golang.org/x/net/context"
+)
+
+func TestGetCredentialsWithoutCredentials(t *testing.T) {
+	m := &CredentialsExpirationManager{}
+
+	if _, err := m.GetCredentials(); err != errUnknownProfile {
+		t.Errorf("GetCredentials = %v, want %v", err, errUnknownProfile)
+	}
+}
+
+func TestRenewAfterLock(t *testing.T) {
+	for _, forget := range []func(*CredentialsExpirationManager) error{
+		(*CredentialsExpirationManager).Lock,
+		(*CredentialsExpirationManager).Logout,
+	} {
+		m := &CredentialsExpirationManager{role: profileDefault}
+		if err := forget(m); err != nil {
+			t.Fatal(err)
+		}
+		reason := m.err
+
+		if err := m.renew(profileDefault, ""); err != reason {
+			t.Errorf("renew = %v, want %v", err, reason)
+		}
+		if _, err := m.GetCredentials(); err != reason {
+			t.Errorf("GetCredentials = %v, want %v", err, reason)
+		}
+	}
+}
+
+func TestRetrieveRoleWhenLocked(t *testing.T) {
+	m := &CredentialsExpirationManager{}
+	if err := m.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.RetrieveRole("role", "", SessionPolicy{}); err != errLocked {
+		t.Errorf("RetrieveRole = %v, want %v", err, errLocked)
+	}
+}
+
+func TestRetrieveRoleAcrossLock(t *testing.T) {
+	m := &CredentialsExpirationManager{}
+	creds := &AwsCredentials{Credentials: sts.Credentials{Expiration: aws.Time(time.Now().Add(time.Hour))}}
+
+	_, err := m.roles.get("role", SessionPolicy{}, "", func() (*AwsCredentials, error) {
+		m.Lock()
+		return creds, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := m.roles.sessions(); len(sessions) != 0 {
+		t.Errorf("credentials retrieved across lock were cached: %v", sessions)
+	}
+}
+
+// idleLocks runs lockWhenIdle with timeout, and returns the channel signalled on every lock
+func idleLocks(t *testing.T, timeout time.Duration) <-chan struct{} {
+	interval := idleCheckInterval
+	idleCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { idleCheckInterval = interval })
+
+	locked := make(chan struct{}, 1)
+	go lockWhenIdle(timeout, func() {
+		select {
+		case locked <- struct{}{}:
+		default:
+		}
+	})
+	return locked
+}
+
+func TestIdleLock(t *testing.T) {
+	touchActivity()
+	locked := idleLocks(t, 100*time.Millisecond)
+
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("not locked after being idle")
+	}
+}
+
+func TestIdleLockActivity(t *testing.T) {
+	touchActivity()
+	locked := idleLocks(t, 200*time.Millisecond)
+
+	// a cli call every 20ms keeps the service unlocked
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	for end := time.Now().Add(500 * time.Millisecond); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+		unaryActivity(context.Background(), nil, nil, handler)
+		select {
+		case <-locked:
+			t.Fatalf("locked while there was cli activity")
+		default:
+		}
+	}
+
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("not locked after the cli calls stopped")
+	}
+}
+
+func TestForget(t *testing.T) {
+	dir := t.TempDir()
+	cache := &sessionCache{
+		path:    filepath.Join(dir, "sessions"),
+		keyPath: filepath.Join(dir, "sessions.key"),
+	}
+	expiration := aws.Time(time.Now().Add(time.Hour))
+	creds := &sts.Credentials{AccessKeyId: aws.String("ASIA"), SecretAccessKey: aws.String("s"), SessionToken: aws.String("t"), Expiration: expiration}
+
+	m := &CredentialsExpirationManager{
+		role:        profileDefault,
+		credentials: creds,
+		sessions:    map[string]*sourceSession{profileDefault: {name: profileDefault, credentials: creds}},
+		cache:       cache,
+	}
+	m.saveSessions()
+	if _, err := os.Stat(cache.path); err != nil {
+		t.Fatalf("the session cache was not saved: %v", err)
+	}
+	m.roles.get("role", SessionPolicy{}, "", func() (*AwsCredentials, error) {
+		return &AwsCredentials{Credentials: *creds}, nil
+	})
+
+	if err := m.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessions := m.roles.sessions(); len(sessions) != 0 {
+		t.Errorf("role cache = %v, want none", sessions)
+	}
+	if len(m.sessions) != 0 || m.credentials != nil {
+		t.Errorf("sessions = %v, credentials = %v, want none", m.sessions, m.credentials)
+	}
+	for _, path := range []string{cache.path, cache.keyPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%v was not removed: %v", path, err)
+		}
+	}
+	if role := m.Role(); role != profileDefault {
+		t.Errorf("role = %v, want %v", role, profileDefault)
+	}
+}
+
+/*
+blockingSTS answers GetSessionToken, after signalling started and waiting for
+release, so that a call to STS can be raced with.
+*/
+func blockingSTS(started chan<- struct{}, release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		fmt.Fprintf(w, `<GetSessionTokenResponse><GetSessionTokenResult><Credentials><AccessKeyId>ASIANEW</AccessKeyId><SecretAccessKey>s</SecretAccessKey><SessionToken>t</SessionToken><Expiration>%v</Expiration></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+}
+
+func TestRefreshRacesWithLock(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_CREDENTIAL_FILE", filepath.Join(dir, "credentials"))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := blockingSTS(started, release)
+	defer srv.Close()
+
+	profile := Profile{AwsAccessKeyID: "AKIA", AwsSecretAccessKey: "secret", Region: "eu-west-1", STSEndpoint: srv.URL}
+	expired := &sts.Credentials{AccessKeyId: aws.String("ASIAOLD"), SecretAccessKey: aws.String("s"), SessionToken: aws.String("t"), Expiration: aws.Time(time.Now().Add(-time.Minute))}
+	s := &sourceSession{name: profileDefault, profile: profile, credentials: expired}
+
+	m := &CredentialsExpirationManager{
+		config:      Config{Profiles: Profiles{profileDefault: profile}},
+		role:        profileDefault,
+		credentials: expired,
+		source:      s,
+		sessions:    map[string]*sourceSession{profileDefault: s},
+	}
+
+	refreshed := make(chan error)
+	go func() { refreshed <- m.refreshCredentials() }()
+	<-started
+
+	locked := make(chan error)
+	go func() { locked <- m.Lock() }()
+	// give Lock the time to wait for the refresh
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-refreshed; err != nil {
+		t.Fatalf("refreshCredentials: %v", err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	if _, err := m.GetCredentials(); err != errLocked {
+		t.Errorf("GetCredentials = %v, want %v", err, errLocked)
+	}
+	if len(m.sessions) != 0 {
+		t.Errorf("sessions = %v, want none", m.sessions)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/bobziuchkovski/writ"
 )
 
@@ -24,6 +27,7 @@ var date = ""
 const (
 	configFilePath   = ".limes/config"
 	domainSocketPath = ".limes/socket"
+	identityFilePath = ".limes/identity.pem"
 	profileDefault   = "default"
 )
 
@@ -56,10 +60,17 @@ type Limes struct {
 	Stop          Stop          `command:"stop" description:"Stop the Instance Metadata Service"`
 	Status        Status        `command:"status" description:"Get current status of the service"`
 	SwitchProfile SwitchProfile `command:"assume" alias:"profile" description:"Assume IAM role"`
+	Login         Login         `command:"login" description:"Log in to IAM Identity Center (AWS SSO)"`
+	Lock          Lock          `command:"lock" description:"Forget all credentials until a profile is assumed again"`
+	Logout        Logout        `command:"logout" description:"Forget all credentials, the active profile and the SSO tokens"`
+	Keys          Keys          `command:"keys" description:"Manage keys in the encrypted keystore"`
+	MFA           MFA           `command:"mfa" description:"Give the MFA tokens the service is waiting for"`
 	RunCmd        RunCmd        `command:"run" description:"Run a command with the specified profile"`
 	ShowCmd       ShowCmd       `command:"show" description:"List/show information"`
 	Env           Env           `command:"env" description:"Set/clear environment variables"`
 	Fix           Fix           `command:"fix" description:"Fix configuration"`
+	CredProcess   CredProcess   `command:"credential-process" description:"Print credentials for credential_process in the AWS configuration"`
+	ConfigureAWS  ConfigureAWS  `command:"configure-aws" description:"Add the limes profiles to the AWS configuration"`
 	Profile       string        `option:"profile" default:"" description:"Profile to assume"`
 	ConfigFile    string        `option:"c, config" default:"" description:"Configuration file"`
 	Address       string        `option:"address" default:"" description:"Address to connect to"`
@@ -94,13 +105,77 @@ type Fix struct {
 
 // SwitchProfile defines the "profile" command cli flags and options
 type SwitchProfile struct {
+	HelpFlag bool   `flag:"h, help" description:"Display this message and exit"`
+	For      string `option:"for" default:"" description:"Revert to the previous profile after e.g. 15m"`
+}
+
+// Login defines the "login" command cli flags and options
+type Login struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// Lock defines the "lock" command cli flags and options
+type Lock struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// Logout defines the "logout" command cli flags and options
+type Logout struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// MFA defines the "mfa" command cli flags and options
+type MFA struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+	List     bool `flag:"l, list" description:"List the pending requests without answering them"`
+}
+
+// Keys defines the "keys" command cli flags and options
+type Keys struct {
+	HelpFlag bool       `flag:"h, help" description:"Display this message and exit"`
+	Add      KeysAdd    `command:"add" description:"Add or replace the keys of a profile"`
+	List     KeysList   `command:"list" description:"List the profiles in the keystore"`
+	Remove   KeysRemove `command:"remove" description:"Remove the keys of a profile"`
+	Rotate   KeysRotate `command:"rotate" description:"Replace the access key of a profile with a new one"`
+	Unlock   KeysUnlock `command:"unlock" description:"Unlock the keystore in the service"`
+}
+
+// KeysAdd defines the "keys add" command cli flags and options
+type KeysAdd struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// KeysList defines the "keys list" command cli flags and options
+type KeysList struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// KeysRemove defines the "keys remove" command cli flags and options
+type KeysRemove struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// KeysRotate defines the "keys rotate" command cli flags and options
+type KeysRotate struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// KeysUnlock defines the "keys unlock" command cli flags and options
+type KeysUnlock struct {
 	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
 }
 
 // RunCmd defines the "run" command cli flags ands options
 type RunCmd struct {
-	HelpFlag bool   `flag:"h, help" description:"Display this message and exit"`
-	Profile  string `option:"profile" default:"" description:"Profile to assume"`
+	HelpFlag  bool     `flag:"h, help" description:"Display this message and exit"`
+	Profile   string   `option:"profile" default:"" description:"Profile to assume"`
+	Container bool     `flag:"container" description:"Use the container credentials endpoint instead of keys"`
+	Static    bool     `flag:"static" description:"Export keys for --profile instead of starting a credentials endpoint"`
+	CleanEnv  bool     `flag:"clean-env" description:"Only pass a minimal environment to the command"`
+	EnvFiles  []string `option:"env-file" description:"Read environment variables from file"`
+	Policy    string   `option:"policy" description:"Limit the permissions with the session policy in file"`
+	PolicyARN []string `option:"policy-arn" description:"Limit the permissions with a managed policy"`
+	ReadOnly  bool     `flag:"read-only" description:"Limit the permissions to ReadOnlyAccess"`
 }
 
 // ShowCmd defines the "show" command cli flags ands options
@@ -110,8 +185,23 @@ type ShowCmd struct {
 
 // Env defines the "env" subcommand cli flags and options
 type Env struct {
+	HelpFlag  bool     `flag:"h, help" description:"Display this message and exit"`
+	Clear     bool     `flag:"clear" description:"Clear environment variables"`
+	Container bool     `flag:"container" description:"Use the container credentials endpoint instead of keys"`
+	Format    string   `option:"f, format" default:"bash" description:"Output format: bash, zsh, fish, powershell, dotenv, json or credential_process"`
+	Policy    string   `option:"policy" description:"Limit the permissions with the session policy in file"`
+	PolicyARN []string `option:"policy-arn" description:"Limit the permissions with a managed policy"`
+	ReadOnly  bool     `flag:"read-only" description:"Limit the permissions to ReadOnlyAccess"`
+}
+
+// CredProcess defines the "credential-process" subcommand cli flags and options
+type CredProcess struct {
+	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
+}
+
+// ConfigureAWS defines the "configure-aws" subcommand cli flags and options
+type ConfigureAWS struct {
 	HelpFlag bool `flag:"h, help" description:"Display this message and exit"`
-	Clear    bool `flag:"clear" description:"Clear environment variables"`
 }
 
 // Run is the main cli handler
@@ -130,9 +220,6 @@ func (l *Start) Run(cmd *Limes, p writ.Path, positional []string) {
 		p.Last().ExitHelp(nil)
 	}
 
-	if cmd.Profile == "" {
-		cmd.Profile = profileDefault
-	}
 	StartService(cmd.ConfigFile, cmd.Address, cmd.Profile, l.MFA, l.Port, l.Fake)
 }
 
@@ -242,9 +329,327 @@ func (l *SwitchProfile) Run(cmd *Limes, p writ.Path, positional []string) {
 		p.Last().ExitHelp(errors.New("profile name is required"))
 	}
 
+	var d time.Duration
+	if l.For != "" {
+		var err error
+		d, err = time.ParseDuration(l.For)
+		if err != nil || d <= 0 {
+			p.Last().ExitHelp(fmt.Errorf("invalid duration: %v", l.For))
+		}
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+	rpc.assumeRole(positional[0], "", d)
+}
+
+// Run is the handler for the login command
+func (l *Login) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	if len(positional) != 1 {
+		p.Last().ExitHelp(errors.New("profile name is required"))
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+	if err := rpc.login(positional[0]); err != nil {
+		fmt.Fprint(errout, lookupCorrection(err))
+		os.Exit(1)
+	}
+}
+
+// Run is the handler for the lock command
+func (l *Lock) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+	if rpc.lock() != nil {
+		os.Exit(1)
+	}
+}
+
+// Run is the handler for the logout command
+func (l *Logout) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+	if rpc.logout() != nil {
+		os.Exit(1)
+	}
+}
+
+// Run is the handler for the mfa command
+func (l *MFA) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+
+	requests, err := rpc.pendingMFA()
+	if err != nil {
+		fmt.Fprint(errout, lookupCorrection(err))
+		os.Exit(1)
+	}
+
+	if len(requests) == 0 {
+		fmt.Fprintf(out, "No pending MFA requests\n")
+		return
+	}
+
+	if l.List {
+		for _, req := range requests {
+			fmt.Fprintf(out, "%v\t%v\t%v\t%v\n", req.Id, req.Profile, req.Serial, req.Created)
+		}
+		return
+	}
+
+	for _, req := range requests {
+		if rpc.answerMFA(req) != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// Run is the handler for the keys command
+func (l *Keys) Run(cmd *Limes, p writ.Path, positional []string) {
+	p.Last().ExitHelp(errors.New("COMMAND is required"))
+}
+
+// Run is the handler for the keys add command
+func (l *KeysAdd) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	if len(positional) != 1 {
+		p.Last().ExitHelp(errors.New("profile name is required"))
+	}
+	name := positional[0]
+
+	path, keys, passphrase := openKeystore(true)
+
+	accessKeyID, err := askLine("AWS Access Key ID: ", false)
+	exitOnErr(err)
+	secretAccessKey, err := askLine("AWS Secret Access Key: ", true)
+	exitOnErr(err)
+
+	if accessKeyID == "" || secretAccessKey == "" {
+		exitOnErr(errors.New("both the access key ID and the secret access key are required"))
+	}
+
+	keys[name] = storedKey{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+	}
+	exitOnErr(writeKeystore(path, passphrase, keys))
+	fmt.Fprintf(out, "# stored keys for %v in %v\n", name, path)
+
+	reloadKeystore(cmd.Address, passphrase)
+}
+
+// Run is the handler for the keys list command
+func (l *KeysList) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	_, keys, _ := openKeystore(false)
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "%v\t%v\n", name, keys[name].AccessKeyID)
+	}
+}
+
+// Run is the handler for the keys remove command
+func (l *KeysRemove) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	if len(positional) != 1 {
+		p.Last().ExitHelp(errors.New("profile name is required"))
+	}
+	name := positional[0]
+
+	path, keys, passphrase := openKeystore(false)
+	if _, ok := keys[name]; !ok {
+		exitOnErr(fmt.Errorf("no keys stored for %v", name))
+	}
+
+	delete(keys, name)
+	exitOnErr(writeKeystore(path, passphrase, keys))
+	fmt.Fprintf(out, "# removed keys for %v from %v\n", name, path)
+
+	reloadKeystore(cmd.Address, passphrase)
+}
+
+// Run is the handler for the keys rotate command
+func (l *KeysRotate) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	if len(positional) != 1 {
+		p.Last().ExitHelp(errors.New("profile name is required"))
+	}
+	name := positional[0]
+
+	if cmd.ConfigFile == "" {
+		exitOnErr(errors.New("no configuration file given"))
+	}
+	config, err := readConfig(cmd.ConfigFile)
+	exitOnErr(err)
+
+	profile, ok := config.Profiles[name]
+	if !ok {
+		exitOnErr(fmt.Errorf("unknown profile: %v", name))
+	}
+
+	var old credentials.Value
+	var save func(credentials.Value) error
+	var done func()
+
+	switch profile.CredentialSource {
+	case "", credentialSourceStatic:
+		old = credentials.Value{
+			AccessKeyID:     profile.AwsAccessKeyID,
+			SecretAccessKey: profile.AwsSecretAccessKey,
+		}
+		save = func(key credentials.Value) error {
+			return replaceKeyInConfig(cmd.ConfigFile, old, key)
+		}
+		done = func() {
+			fmt.Fprintf(out, "# stored the new key in %v\n", cmd.ConfigFile)
+			reloadConfig(cmd.Address)
+		}
+	case credentialSourceKey:
+		path, keys, passphrase := openKeystore(false)
+		stored, ok := keys[name]
+		if !ok {
+			exitOnErr(fmt.Errorf("no keys stored for %v", name))
+		}
+		old = credentials.Value{
+			AccessKeyID:     stored.AccessKeyID,
+			SecretAccessKey: stored.SecretAccessKey,
+		}
+		save = func(key credentials.Value) error {
+			if err := backupFile(path); err != nil {
+				return err
+			}
+			keys[name] = storedKey{
+				AccessKeyID:     key.AccessKeyID,
+				SecretAccessKey: key.SecretAccessKey,
+			}
+			return writeKeystore(path, passphrase, keys)
+		}
+		done = func() {
+			fmt.Fprintf(out, "# stored the new key in %v\n", path)
+			reloadKeystore(cmd.Address, passphrase)
+		}
+	default:
+		exitOnErr(fmt.Errorf("keys can not be rotated for credential_source: %v", profile.CredentialSource))
+	}
+
+	if old.AccessKeyID == "" || old.SecretAccessKey == "" {
+		exitOnErr(fmt.Errorf("profile %v has no access key", name))
+	}
+
+	mfa := ""
+	if profile.MFASerial != "" && profile.MFATOTPCommand != "" {
+		mfa, err = profile.totpCode()
+		exitOnErr(err)
+	} else if profile.MFASerial != "" {
+		mfa = askMFA()
+	}
+
+	key, err := rotateAccessKey(profile, old, mfa, save)
+	if key.AccessKeyID != "" {
+		done()
+	}
+	exitOnErr(err)
+	fmt.Fprintf(out, "# rotated %v: %v -> %v\n", name, old.AccessKeyID, key.AccessKeyID)
+}
+
+// Run is the handler for the keys unlock command
+func (l *KeysUnlock) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
 	rpc := newCliClient(cmd.Address)
 	defer rpc.close()
-	rpc.assumeRole(positional[0], "")
+	if rpc.unlock() != nil {
+		os.Exit(1)
+	}
+}
+
+/*
+openKeystore asks for the passphrase and decrypts the keystore. If create is
+set and there is no keystore a new passphrase is asked for instead.
+*/
+func openKeystore(create bool) (path string, keys map[string]storedKey, passphrase string) {
+	path, err := keystorePath()
+	exitOnErr(err)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) && create {
+		passphrase, err = askPassphrase("New keystore passphrase: ")
+		exitOnErr(err)
+		confirm, err := askPassphrase("Repeat passphrase: ")
+		exitOnErr(err)
+
+		if passphrase == "" || passphrase != confirm {
+			exitOnErr(errors.New("the passphrases are empty or do not match"))
+		}
+		return path, make(map[string]storedKey), passphrase
+	}
+
+	passphrase, err = askPassphrase("Keystore passphrase: ")
+	exitOnErr(err)
+
+	keys, err = readKeystore(path, passphrase)
+	exitOnErr(err)
+
+	return path, keys, passphrase
+}
+
+// reloadConfig makes the service, if it is running, read the configuration file again
+func reloadConfig(address string) {
+	rpc := newCliClient(address)
+	defer rpc.close()
+	if err := rpc.reloadConfig(); err != nil && !isServiceDown(err) {
+		fmt.Fprintf(errout, "unable to reload the configuration of the service, restart it to use the new key: %v\n", err)
+	}
+}
+
+// reloadKeystore unlocks the keystore in the service, if it is running, to pick up changes
+func reloadKeystore(address, passphrase string) {
+	rpc := newCliClient(address)
+	defer rpc.close()
+	rpc.reloadKeystore(passphrase)
+}
+
+func exitOnErr(err error) {
+	if err != nil {
+		fmt.Fprintf(errout, "error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 // Run is the handler for the run command
@@ -253,18 +658,95 @@ func (l *RunCmd) Run(cmd *Limes, p writ.Path, positional []string) {
 		p.Last().ExitHelp(nil)
 	}
 
+	os.Exit(l.run(cmd, positional))
+}
+
+// profile returns the profile given to run with --profile, or the global --profile
+func (l *RunCmd) profile(cmd *Limes) string {
+	if l.Profile != "" {
+		return l.Profile
+	}
+	return cmd.Profile
+}
+
+// run starts the command and returns its exit code
+func (l *RunCmd) run(cmd *Limes, positional []string) int {
+	env, err := commandEnv(l.CleanEnv, l.EnvFiles)
+	if err != nil {
+		fmt.Fprintf(errout, "error reading environment: %v\n", err)
+		return 1
+	}
+
+	policy, err := sessionPolicyFlags(l.Policy, l.PolicyARN, l.ReadOnly)
+	if err != nil {
+		fmt.Fprintf(errout, "error reading session policy: %v\n", err)
+		return 1
+	}
+
 	command := exec.Command(positional[0], positional[1:]...)
 
 	rpc := newCliClient(cmd.Address)
 	defer rpc.close()
 
-	if cmd.Profile != "" {
-		creds, err := rpc.retreiveAWSEnv(cmd.Profile, "")
+	profile := l.profile(cmd)
+	if policy != nil && profile == "" && !l.Container {
+		// session policies are applied when the role is assumed
+		r, err := rpc.status()
 		if err != nil {
-			fmt.Fprintf(errout, "error retreving profile: %v", err)
-			os.Exit(1)
+			fmt.Fprintf(errout, "error retreving profile: %v\n", lookupCorrection(err))
+			return 1
+		}
+		profile = r.Role
+	}
+
+	if l.Container && policy != nil {
+		fmt.Fprintf(errout, "error: session policies can not be used with --container\n")
+		return 1
+	} else if l.Container {
+		cenv, err := rpc.retreiveContainerEnv(profile)
+		if err != nil {
+			fmt.Fprintf(errout, "error retreving container credentials: %v\n", err)
+			return 1
+		}
+		command.Env = append(env,
+			containerCredentialsURIEnv+"="+cenv.FullURI,
+			containerAuthorizationEnv+"="+cenv.AuthorizationToken,
+			"AWS_DEFAULT_REGION="+cenv.Region,
+			"AWS_REGION="+cenv.Region,
+		)
+	} else if profile != "" && !l.Static {
+		creds, err := rpc.retreiveAWSEnv(profile, "", policy)
+		if err != nil {
+			fmt.Fprintf(errout, "error retreving profile: %v\n", err)
+			return 1
+		}
+
+		source, err := newCliCredentialsSource(rpc, profile, policy, creds)
+		if err != nil {
+			fmt.Fprintf(errout, "error retreving profile: %v\n", err)
+			return 1
+		}
+
+		endpoint, err := startCredentialsEndpoint(source)
+		if err != nil {
+			fmt.Fprintf(errout, "error starting credentials endpoint: %v\n", err)
+			return 1
+		}
+		defer endpoint.Stop()
+
+		command.Env = append(env,
+			containerCredentialsURIEnv+"="+endpoint.URI(),
+			containerAuthorizationEnv+"="+endpoint.Token(),
+			"AWS_DEFAULT_REGION="+creds.Region,
+			"AWS_REGION="+creds.Region,
+		)
+	} else if profile != "" {
+		creds, err := rpc.retreiveAWSEnv(profile, "", policy)
+		if err != nil {
+			fmt.Fprintf(errout, "error retreving profile: %v\n", err)
+			return 1
 		}
-		command.Env = append(os.Environ(),
+		command.Env = append(env,
 			"AWS_ACCESS_KEY_ID="+creds.AccessKeyID,
 			"AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey,
 			"AWS_SESSION_TOKEN="+creds.SessionToken,
@@ -274,10 +756,10 @@ func (l *RunCmd) Run(cmd *Limes, p writ.Path, positional []string) {
 	} else {
 		r, err := rpc.status()
 		if err != nil || r.AccessKeyId == "" {
-			fmt.Fprintf(errout, "error retreving profile: %v", err)
-			os.Exit(1)
+			fmt.Fprintf(errout, "error retreving profile: %v\n", err)
+			return 1
 		}
-		command.Env = append(os.Environ(),
+		command.Env = append(env,
 			"AWS_ACCESS_KEY_ID="+r.AccessKeyId,
 			"AWS_SECRET_ACCESS_KEY="+r.SecretAccessKey,
 			"AWS_SESSION_TOKEN="+r.SessionToken,
@@ -289,15 +771,12 @@ func (l *RunCmd) Run(cmd *Limes, p writ.Path, positional []string) {
 	command.Stdin = os.Stdin
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
-	err := command.Run()
-	if err != nil {
-		// TODO: Handle exit error
-	}
+	return exitCode(runSupervised(command))
 }
 
 // Run is the handler for the show subcommand
 func (l *ShowCmd) Run(cmd *Limes, p writ.Path, positional []string) {
-	options := []string{"profiles"}
+	options := []string{"profiles", "sessions", "certificate"}
 	msg := fmt.Errorf("valid components: %v\n", strings.Join(options, ", "))
 
 	if l.HelpFlag {
@@ -318,6 +797,24 @@ func (l *ShowCmd) Run(cmd *Limes, p writ.Path, positional []string) {
 			os.Exit(1)
 		}
 		fmt.Printf("%v\n", strings.Join(roles, "\n"))
+	case "sessions":
+		rpc := newCliClient(cmd.Address)
+		defer rpc.close()
+		sessions, err := rpc.sessions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		printSessions(sessions)
+	case "certificate":
+		rpc := newCliClient(cmd.Address)
+		defer rpc.close()
+		cert, err := rpc.certificate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(cert)
 	default:
 		p.Last().ExitHelp(msg)
 	}
@@ -329,6 +826,19 @@ func (l *Env) Run(cmd *Limes, p writ.Path, positional []string) {
 		p.Last().ExitHelp(nil)
 	}
 
+	format, ok := envFormats[l.Format]
+	if !ok && l.Format != formatCredentialProcess {
+		p.Last().ExitHelp(fmt.Errorf("unknown format: %v, valid formats: %v", l.Format, strings.Join(envFormatNames(), ", ")))
+	}
+
+	if l.Clear {
+		if format.unset == nil {
+			p.Last().ExitHelp(fmt.Errorf("--clear is not supported by the %v format", l.Format))
+		}
+		format.unset(out, envVars)
+		return
+	}
+
 	profile := ""
 	if cmd.Profile != "" {
 		profile = cmd.Profile
@@ -338,13 +848,50 @@ func (l *Env) Run(cmd *Limes, p writ.Path, positional []string) {
 		profile = positional[0]
 	}
 
+	policy, err := sessionPolicyFlags(l.Policy, l.PolicyARN, l.ReadOnly)
+	if err != nil {
+		fmt.Fprintf(errout, "error reading session policy: %v\n", err)
+		os.Exit(1)
+	}
+	if policy != nil && l.Container {
+		p.Last().ExitHelp(errors.New("session policies can not be used with --container"))
+	}
+
+	usage := "limes env"
+	if l.Format != envFormatDefault {
+		usage += " --format " + l.Format
+	}
+
 	rpc := newCliClient(cmd.Address)
 	defer rpc.close()
 
+	if l.Container {
+		if l.Format == formatCredentialProcess {
+			p.Last().ExitHelp(fmt.Errorf("--container is not supported by the %v format", l.Format))
+		}
+
+		env, err := rpc.retreiveContainerEnv(profile)
+		if err != nil {
+			fmt.Fprintf(errout, "error retreiving container credentials: %v\n", err)
+			os.Exit(1)
+		}
+
+		if format.unset != nil {
+			format.unset(out, []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"})
+		}
+		l.print(format, usage+" --container", []envVar{
+			{containerCredentialsURIEnv, env.FullURI},
+			{containerAuthorizationEnv, env.AuthorizationToken},
+			{"AWS_DEFAULT_REGION", env.Region},
+			{"AWS_REGION", env.Region},
+		})
+		return
+	}
+
 	if profile == "" {
 		r, err := rpc.status()
 		if err != nil {
-			p.Last().ExitHelp(fmt.Errorf(lookupCorrection(err)))
+			p.Last().ExitHelp(errors.New(lookupCorrection(err)))
 		}
 		profile = r.Role
 		if profile == "" {
@@ -352,18 +899,127 @@ func (l *Env) Run(cmd *Limes, p writ.Path, positional []string) {
 		}
 	}
 
-	credentials, err := rpc.retreiveAWSEnv(profile, "")
+	credentials, err := rpc.retreiveAWSEnv(profile, "", policy)
 	if err != nil {
 		fmt.Fprintf(errout, "error retreiving profile: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Fprintf(out, "export AWS_ACCESS_KEY_ID=%v\n", credentials.AccessKeyID)
-	fmt.Fprintf(out, "export AWS_SECRET_ACCESS_KEY=%v\n", credentials.SecretAccessKey)
-	fmt.Fprintf(out, "export AWS_SESSION_TOKEN=%v\n", credentials.SessionToken)
-	fmt.Fprintf(out, "export AWS_DEFAULT_REGION=%v\n", credentials.Region)
-	fmt.Fprintf(out, "export AWS_REGION=%v\n", credentials.Region)
-	fmt.Fprintf(out, "# Run this command to configure your shell:\n")
-	fmt.Fprintf(out, "# eval \"$(limes env %s)\"\n", profile)
+
+	if l.Format == formatCredentialProcess {
+		err = writeCredentialProcess(out, credentials)
+		if err != nil {
+			fmt.Fprintf(errout, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	l.print(format, usage+" "+profile, []envVar{
+		{"AWS_ACCESS_KEY_ID", credentials.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", credentials.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", credentials.SessionToken},
+		{"AWS_DEFAULT_REGION", credentials.Region},
+		{"AWS_REGION", credentials.Region},
+	})
+}
+
+// print writes vars in format, followed by instructions on how to use the output
+func (l *Env) print(format envFormat, command string, vars []envVar) {
+	err := format.set(out, vars)
+	if err != nil {
+		fmt.Fprintf(errout, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if format.usage != "" {
+		fmt.Fprintf(out, "# Run this command to configure your shell:\n")
+		fmt.Fprintf(out, "# %v\n", fmt.Sprintf(format.usage, command))
+	}
+}
+
+// Run is the handler for the credential-process subcommand
+func (l *CredProcess) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	if len(positional) != 1 {
+		p.Last().ExitHelp(errors.New("profile name is required"))
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+
+	credentials, err := rpc.retreiveAWSEnv(positional[0], "", nil)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	err = writeCredentialProcess(out, credentials)
+	if err != nil {
+		fmt.Fprintf(errout, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Run is the handler for the configure-aws subcommand
+func (l *ConfigureAWS) Run(cmd *Limes, p writ.Path, positional []string) {
+	if l.HelpFlag {
+		p.Last().ExitHelp(nil)
+	}
+
+	rpc := newCliClient(cmd.Address)
+	defer rpc.close()
+
+	profiles, err := rpc.profiles()
+	if err != nil {
+		fmt.Fprintf(errout, "%v\n", err)
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		executable = "limes"
+	}
+	command := quoteShell(executable)
+	if cmd.Address != setDefaultSocketAddress("") {
+		command += " --address " + quoteShell(cmd.Address)
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		// the default profile is served by the metadata service
+		if name != profileDefault {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entries := make([]awsProfile, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, awsProfile{
+			Name:              name,
+			Region:            profiles[name].Region,
+			CredentialProcess: command + " credential-process " + quoteShell(name),
+		})
+	}
+
+	path, err := awsConfigPath()
+	if err != nil {
+		fmt.Fprintf(errout, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	skipped, err := configureAWSProfiles(path, entries)
+	if err != nil {
+		fmt.Fprintf(errout, "error updating %v: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	for _, name := range skipped {
+		fmt.Fprintf(errout, "# skipping %v: profile already defined in %v\n", name, path)
+	}
+	fmt.Fprintf(out, "# wrote %v profiles to %v\n", len(entries)-len(skipped), path)
 }
 
 func setDefaultSocketAddress(address string) string {
@@ -392,13 +1048,39 @@ func setDefaultConfigPath(path string) string {
 	return filepath.Join(home, configFilePath)
 }
 
+// runOptions are the options of the run subcommand that takes a value
+var runOptions = map[string]bool{
+	"--profile":    true,
+	"--env-file":   true,
+	"--policy":     true,
+	"--policy-arn": true,
+}
+
+// injectCmdBreak inserts "--" after needle and the flags following it, so that
+// the flags of the command to run are not parsed by limes
 func injectCmdBreak(needle string, args []string) []string {
 	ret := make([]string, 0, len(args)+1)
-	for _, arg := range os.Args {
-		ret = append(ret, arg)
-		if arg == needle {
-			ret = append(ret, "--")
+	for i := 0; i < len(args); i++ {
+		ret = append(ret, args[i])
+		if args[i] != needle {
+			continue
 		}
+
+		for i+1 < len(args) && strings.HasPrefix(args[i+1], "-") && args[i+1] != "--" {
+			i++
+			ret = append(ret, args[i])
+			if runOptions[args[i]] && i+1 < len(args) {
+				i++
+				ret = append(ret, args[i])
+			}
+		}
+
+		if i+1 < len(args) && args[i+1] == "--" {
+			return append(ret, args[i+1:]...)
+		}
+
+		ret = append(ret, "--")
+		return append(ret, args[i+1:]...)
 	}
 	return ret
 }
@@ -411,21 +1093,30 @@ func main() {
 	cmd.Subcommand("stop").Help.Usage = "Usage: limes stop"
 	cmd.Subcommand("status").Help.Usage = "Usage: limes status"
 	cmd.Subcommand("fix").Help.Usage = "Usage: limes fix [--restore]"
-	cmd.Subcommand("assume").Help.Usage = "Usage: limes assume <profile>"
+	cmd.Subcommand("assume").Help.Usage = "Usage: limes assume [--for <duration>] <profile>|-"
+	cmd.Subcommand("login").Help.Usage = "Usage: limes login <profile>"
+	cmd.Subcommand("lock").Help.Usage = "Usage: limes lock"
+	cmd.Subcommand("logout").Help.Usage = "Usage: limes logout"
+	cmd.Subcommand("mfa").Help.Usage = "Usage: limes mfa [--list]"
+	cmd.Subcommand("keys").Help.Usage = "Usage: limes keys COMMAND <profile>"
+	cmd.Subcommand("keys").Subcommand("add").Help.Usage = "Usage: limes keys add <profile>"
+	cmd.Subcommand("keys").Subcommand("list").Help.Usage = "Usage: limes keys list"
+	cmd.Subcommand("keys").Subcommand("remove").Help.Usage = "Usage: limes keys remove <profile>"
+	cmd.Subcommand("keys").Subcommand("rotate").Help.Usage = "Usage: limes keys rotate <profile>"
+	cmd.Subcommand("keys").Subcommand("unlock").Help.Usage = "Usage: limes keys unlock"
 	cmd.Subcommand("show").Help.Usage = "Usage: limes show [component]"
-	cmd.Subcommand("env").Help.Usage = "Usage: limes env <profile>"
-	cmd.Subcommand("run").Help.Usage = "Usage: limes [--profile <name>] run <cmd> [arg...]"
+	cmd.Subcommand("env").Help.Usage = "Usage: limes env [--format <format>] [--clear] [--container] [--policy <file>] [--policy-arn <arn>]... [--read-only] <profile>"
+	cmd.Subcommand("credential-process").Help.Usage = "Usage: limes credential-process <profile>"
+	cmd.Subcommand("configure-aws").Help.Usage = "Usage: limes configure-aws"
+	cmd.Subcommand("run").Help.Usage = "Usage: limes [--profile <name>] run [--profile <name>] [--container|--static] [--clean-env] [--env-file <file>] [--policy <file>] [--policy-arn <arn>]... [--read-only] <cmd> [arg...]"
 
 	path, positional, err := cmd.Decode(os.Args[1:])
-	if err != nil {
-		if path.String() != "limes run" {
-			path.Last().ExitHelp(err)
-		}
+	if path.String() == "limes run" {
 		os.Args = injectCmdBreak("run", os.Args)
 		path, positional, err = cmd.Decode(os.Args[1:])
-		if err != nil {
-			path.Last().ExitHelp(err)
-		}
+	}
+	if err != nil {
+		path.Last().ExitHelp(err)
 	}
 
 	limes.Address = setDefaultSocketAddress(limes.Address)
@@ -447,10 +1138,34 @@ func main() {
 		limes.Fix.Run(limes, path, positional)
 	case "limes assume":
 		limes.SwitchProfile.Run(limes, path, positional)
+	case "limes login":
+		limes.Login.Run(limes, path, positional)
+	case "limes lock":
+		limes.Lock.Run(limes, path, positional)
+	case "limes logout":
+		limes.Logout.Run(limes, path, positional)
+	case "limes mfa":
+		limes.MFA.Run(limes, path, positional)
+	case "limes keys":
+		limes.Keys.Run(limes, path, positional)
+	case "limes keys add":
+		limes.Keys.Add.Run(limes, path, positional)
+	case "limes keys list":
+		limes.Keys.List.Run(limes, path, positional)
+	case "limes keys remove":
+		limes.Keys.Remove.Run(limes, path, positional)
+	case "limes keys rotate":
+		limes.Keys.Rotate.Run(limes, path, positional)
+	case "limes keys unlock":
+		limes.Keys.Unlock.Run(limes, path, positional)
 	case "limes show":
 		limes.ShowCmd.Run(limes, path, positional)
 	case "limes env":
 		limes.Env.Run(limes, path, positional)
+	case "limes credential-process":
+		limes.CredProcess.Run(limes, path, positional)
+	case "limes configure-aws":
+		limes.ConfigureAWS.Run(limes, path, positional)
 	case "limes run":
 		limes.RunCmd.Run(limes, path, positional)
 	default:
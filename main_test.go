@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobziuchkovski/writ"
+)
+
+// decodeArgs parses args like main, with the program name first
+func decodeArgs(t *testing.T, args []string) (*Limes, []string) {
+	limes := &Limes{}
+	cmd := writ.New("limes", limes)
+
+	path, positional, err := cmd.Decode(args[1:])
+	if path.String() == "limes run" {
+		args = injectCmdBreak("run", args)
+		path, positional, err = cmd.Decode(args[1:])
+	}
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return limes, positional
+}
+
+func TestRunProfile(t *testing.T) {
+	tests := []struct {
+		args       []string
+		profile    string
+		positional []string
+	}{
+		{[]string{"limes", "run", "--profile", "x", "--", "cmd"}, "x", []string{"cmd"}},
+		{[]string{"limes", "run", "--profile", "x", "cmd", "--profile", "y"}, "x", []string{"cmd", "--profile", "y"}},
+		{[]string{"limes", "--profile", "x", "run", "cmd"}, "x", []string{"cmd"}},
+		{[]string{"limes", "--profile", "x", "run", "--profile", "y", "cmd"}, "y", []string{"cmd"}},
+		{[]string{"limes", "run", "cmd", "-v"}, "", []string{"cmd", "-v"}},
+	}
+
+	for _, test := range tests {
+		limes, positional := decodeArgs(t, test.args)
+		if profile := limes.RunCmd.profile(limes); profile != test.profile {
+			t.Errorf("%v: profile = %q, want %q", test.args, profile, test.profile)
+		}
+		if !reflect.DeepEqual(positional, test.positional) {
+			t.Errorf("%v: command = %q, want %q", test.args, positional, test.positional)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,8 +43,21 @@ type MetadataService interface {
 // CredentialsSource is used for retreiving and renewing AWS credentials
 type CredentialsSource interface {
 	GetCredentials() (*sts.Credentials, error)
+	Role() string
+	Region() string
 }
 
+// Values used when the real value can not be derived from the active profile
+const (
+	defaultRegion    = "us-east-1"
+	fakeAccountID    = "000000000000"
+	fakeAMIID        = "ami-deadbeef"
+	fakeInstanceID   = "i-deadbeef"
+	fakeInstanceType = "t2.micro"
+	fakeLocalIPv4    = "127.0.0.1"
+	fakeMAC          = "02:00:00:de:ad:be"
+)
+
 /*
 metadataService is the internal implementation of the public interface.
 It serves as a reference implementation of the EC2 HTTP API for workstations.
@@ -48,6 +65,10 @@ It serves as a reference implementation of the EC2 HTTP API for workstations.
 type metadataService struct {
 	listener net.Listener
 	creds    CredentialsSource
+	config   Config
+	tokens   *tokenStore
+	identity *instanceIdentity
+	started  time.Time
 }
 
 func (mds *metadataService) Start() error {
@@ -61,13 +82,10 @@ Spawned in the background.
 */
 func (mds *metadataService) listen() {
 	handler := http.NewServeMux()
-	handler.HandleFunc("/latest/meta-data/iam/security-credentials/", mds.enumerateRoles)
-	handler.HandleFunc("/latest/meta-data/iam/security-credentials/ims", mds.getCredentials)
-	handler.HandleFunc("/latest/meta-data/instance-id", mds.getInstanceID)
-	handler.HandleFunc("/latest/meta-data/placement/availability-zone", mds.getAvailabilityZone)
-	handler.HandleFunc("/latest/meta-data/public-hostname", mds.getPublicDNS)
+	handler.HandleFunc(imdsTokenPath, mds.putToken)
+	handler.HandleFunc("/", mds.serveMetadata)
 
-	err := http.Serve(mds.listener, handler)
+	err := http.Serve(mds.listener, trackActivity(mds.checkToken(handler)))
 
 	if err != nil {
 		if strings.HasSuffix(err.Error(), "use of closed network connection") {
@@ -94,29 +112,383 @@ func (mds *metadataService) Port() int {
 }
 
 /*
-Enumerates the available instance profiles on this fake instance.
-Seems like Amazon only supports one.
+metadataDir is a directory in the metadata category tree. Entries are either
+another metadataDir, a string holding the value of a leaf or a metadataLeaf
+for leaves that need to be computed when requested.
+*/
+type metadataDir map[string]interface{}
+
+// metadataLeaf is a leaf in the metadata category tree that writes its own response
+type metadataLeaf func(w http.ResponseWriter, r *http.Request)
+
+/*
+list returns the names of the entries in the directory, one per line. Sub
+directories are suffixed with a slash if slash is true.
+*/
+func (d metadataDir) list(slash bool) string {
+	names := make([]string, 0, len(d))
+	for name, entry := range d {
+		if _, ok := entry.(metadataDir); ok && slash {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, "\n")
+}
+
+/*
+serveMetadata walks the category tree and serves the leaf or directory listing
+found at the request path. Paths not in the tree returns 404.
+*/
+func (mds *metadataService) serveMetadata(w http.ResponseWriter, r *http.Request) {
+	var entry interface{} = mds.tree()
+
+	parts := []string{}
+	if path := strings.Trim(r.URL.Path, "/"); path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	for _, part := range parts {
+		dir, ok := entry.(metadataDir)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		entry, ok = dir[part]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	switch e := entry.(type) {
+	case metadataDir:
+		// The version and top level categories are listed without slashes
+		fmt.Fprint(w, e.list(len(parts) > 1))
+	case metadataLeaf:
+		e(w, r)
+	case string:
+		fmt.Fprint(w, e)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+/*
+tree returns the instance metadata category tree.
+
+Values not configured are constructed to be obviously wrong and would never be
+found in the production environment.
+*/
+func (mds *metadataService) tree() metadataDir {
+	md := mds.metadata()
+	region := mds.region()
+	publicHostname := "ec2-0-0-0-0." + region + ".compute.amazonaws.com"
+	mac := fakeMAC
+
+	latest := metadataDir{
+		"dynamic": metadataDir{
+			"instance-identity": metadataDir{
+				"document":  metadataLeaf(mds.getIdentityDocument),
+				"pkcs7":     metadataLeaf(mds.getIdentityPKCS7),
+				"rsa2048":   metadataLeaf(mds.getIdentityRSA2048),
+				"signature": metadataLeaf(mds.getIdentitySignature),
+			},
+		},
+		"meta-data": metadataDir{
+			"ami-id":              md.AMIID,
+			"ami-launch-index":    "0",
+			"ami-manifest-path":   "(unknown)",
+			"hostname":            md.Hostname,
+			"instance-action":     "none",
+			"instance-id":         md.InstanceID,
+			"instance-life-cycle": "on-demand",
+			"instance-type":       md.InstanceType,
+			"local-hostname":      md.Hostname,
+			"local-ipv4":          fakeLocalIPv4,
+			"mac":                 mac,
+			"public-hostname":     publicHostname,
+			"public-ipv4":         "0.0.0.0",
+			"reservation-id":      "r-deadbeef",
+			"security-groups":     "default",
+			"iam": metadataDir{
+				"info": metadataLeaf(mds.getIAMInfo),
+				"security-credentials": metadataDir{
+					"ims": metadataLeaf(mds.getCredentials),
+				},
+			},
+			"network": metadataDir{
+				"interfaces": metadataDir{
+					"macs": metadataDir{
+						mac: metadataDir{
+							"device-number":          "0",
+							"interface-id":           "eni-deadbeef",
+							"local-hostname":         md.Hostname,
+							"local-ipv4s":            fakeLocalIPv4,
+							"mac":                    mac,
+							"owner-id":               mds.accountID(),
+							"public-hostname":        publicHostname,
+							"public-ipv4s":           "0.0.0.0",
+							"security-group-ids":     "sg-deadbeef",
+							"security-groups":        "default",
+							"subnet-id":              "subnet-deadbeef",
+							"subnet-ipv4-cidr-block": "127.0.0.0/8",
+							"vpc-id":                 "vpc-deadbeef",
+							"vpc-ipv4-cidr-block":    "127.0.0.0/8",
+							"vpc-ipv4-cidr-blocks":   "127.0.0.0/8",
+						},
+					},
+				},
+			},
+			"placement": metadataDir{
+				"availability-zone": md.AvailabilityZone,
+				"region":            region,
+			},
+			"services": metadataDir{
+				"domain":    "amazonaws.com",
+				"partition": "aws",
+			},
+		},
+	}
+
+	if len(md.Tags) > 0 {
+		tags := make(metadataDir, len(md.Tags))
+		for k, v := range md.Tags {
+			tags[k] = v
+		}
+		latest["meta-data"].(metadataDir)["tags"] = metadataDir{"instance": tags}
+	}
+
+	if md.UserData != "" || md.UserDataFile != "" {
+		latest["user-data"] = metadataLeaf(func(w http.ResponseWriter, r *http.Request) {
+			mds.getUserData(w, r, md)
+		})
+	}
+
+	return metadataDir{"latest": latest}
+}
+
+/*
+metadata returns the metadata values of the active profile. Values not set on the
+profile are taken from the global configuration, or given a fake default.
+*/
+func (mds *metadataService) metadata() Metadata {
+	md := Metadata{
+		AMIID:        fakeAMIID,
+		InstanceID:   fakeInstanceID,
+		InstanceType: fakeInstanceType,
+	}.override(mds.config.Metadata)
+
+	if profile, ok := mds.config.Profiles[mds.creds.Role()]; ok {
+		md = md.override(profile.Metadata)
+	}
+
+	region := mds.region()
+	if md.AvailabilityZone == "" {
+		md.AvailabilityZone = region + "a"
+	}
+	if md.Hostname == "" {
+		md.Hostname = "ip-127-0-0-1." + internalDomain(region)
+	}
+
+	return md
+}
+
+// region returns the region of the active profile
+func (mds *metadataService) region() string {
+	if region := mds.creds.Region(); region != "" {
+		return region
+	}
+	return defaultRegion
+}
+
+/*
+accountID returns the account ID of the role assumed by the active profile, or a
+dummy account ID if the profile does not have a role.
+*/
+func (mds *metadataService) accountID() string {
+	profile, ok := mds.config.Profiles[mds.creds.Role()]
+	if !ok {
+		return fakeAccountID
+	}
+
+	switch {
+	case profile.saml():
+		return arnAccountID(profile.SAMLRoleARN)
+	case profile.sso() && profile.SSOAccountID != "":
+		return profile.SSOAccountID
+	default:
+		return arnAccountID(profile.RoleARN)
+	}
+}
+
+// arnAccountID returns the account ID in arn, or a dummy account ID
+func arnAccountID(arn string) string {
+	// arn:aws:iam::123456789012:role/name
+	fields := strings.Split(arn, ":")
+	if len(fields) < 6 || fields[4] == "" {
+		return fakeAccountID
+	}
+
+	return fields[4]
+}
+
+// internalDomain returns the domain used for private DNS names in region
+func internalDomain(region string) string {
+	if region == "us-east-1" {
+		return "ec2.internal"
+	}
+	return region + ".compute.internal"
+}
+
+/*
+identityDocument returns the instance identity document of the fake instance.
+*/
+func (mds *metadataService) identityDocument() ([]byte, error) {
+	md := mds.metadata()
+	doc := &identityDocument{
+		AccountID:        mds.accountID(),
+		Architecture:     architecture(),
+		AvailabilityZone: md.AvailabilityZone,
+		ImageID:          md.AMIID,
+		InstanceID:       md.InstanceID,
+		InstanceType:     md.InstanceType,
+		PendingTime:      mds.started.UTC().Format(time.RFC3339),
+		PrivateIP:        fakeLocalIPv4,
+		Region:           mds.region(),
+		Version:          "2017-09-30",
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// architecture returns the EC2 name of the architecture limes is running on
+func architecture() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	}
+	return runtime.GOARCH
+}
+
+/*
+Returns the instance identity document.
+*/
+func (mds *metadataService) getIdentityDocument(w http.ResponseWriter, r *http.Request) {
+	doc, err := mds.identityDocument()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Write(doc)
+}
+
+/*
+Returns the base64 encoded SHA256 RSA signature of the instance identity document.
 */
-func (mds *metadataService) enumerateRoles(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "ims")
+func (mds *metadataService) getIdentitySignature(w http.ResponseWriter, r *http.Request) {
+	doc, err := mds.identityDocument()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	signature, err := mds.identity.sign(doc)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Fprint(w, wrap(base64.StdEncoding.EncodeToString(signature), 64))
 }
 
 /*
-Return fake data for programs that depend on data from the metadata service.
+Returns the base64 encoded PKCS7 signature of the instance identity document.
+The PEM armor is stripped, as done by the EC2 metadata service.
+*/
+func (mds *metadataService) getIdentityPKCS7(w http.ResponseWriter, r *http.Request) {
+	doc, err := mds.identityDocument()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 
-These fields are constructed to be obviously wrong and would never be found in the
-production environment.
+	signature, err := mds.identity.signPKCS7(doc)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Fprint(w, wrap(base64.StdEncoding.EncodeToString(signature), 64))
+}
+
+/*
+Returns the base64 encoded RSA-2048 PKCS7 signature of the instance identity
+document, with signed attributes and the certificate. The PEM armor is
+stripped, as done by the EC2 metadata service.
 */
-func (mds *metadataService) getInstanceID(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "i-deadbeef")
+func (mds *metadataService) getIdentityRSA2048(w http.ResponseWriter, r *http.Request) {
+	doc, err := mds.identityDocument()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	signature, err := mds.identity.signRSA2048(doc)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Fprint(w, wrap(base64.StdEncoding.EncodeToString(signature), 64))
+}
+
+// wrap splits s into lines of at most n characters
+func wrap(s string, n int) string {
+	lines := make([]string, 0, len(s)/n+1)
+	for len(s) > n {
+		lines = append(lines, s[:n])
+		s = s[n:]
+	}
+	lines = append(lines, s)
+
+	return strings.Join(lines, "\n")
 }
 
-func (mds *metadataService) getAvailabilityZone(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "eu-west-1")
+/*
+Returns the user data, either configured inline or read from a file.
+*/
+func (mds *metadataService) getUserData(w http.ResponseWriter, r *http.Request, md Metadata) {
+	if md.UserDataFile == "" {
+		fmt.Fprint(w, md.UserData)
+		return
+	}
+
+	userData, err := ioutil.ReadFile(md.UserDataFile)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Write(userData)
 }
 
-func (mds *metadataService) getPublicDNS(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "ec2-0-0-0-0.eu-west-1.compute.amazonaws.com")
+/*
+Returns information about the instance profile associated with the fake instance.
+*/
+func (mds *metadataService) getIAMInfo(w http.ResponseWriter, r *http.Request) {
+	resp := &iamInfoResponse{
+		Code:               "Success",
+		LastUpdated:        time.Now().UTC().Format(time.RFC3339),
+		InstanceProfileArn: fmt.Sprintf("arn:aws:iam::%s:instance-profile/ims", mds.accountID()),
+		InstanceProfileID:  "AIPADEADBEEFDEADBEEF",
+	}
+	respBody, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	w.Write(respBody)
 }
 
 /*
@@ -148,10 +520,14 @@ func (mds *metadataService) getCredentials(w http.ResponseWriter, r *http.Reques
 /*
 NewMetadataService returns a properly-initialized metadataService for use.
 */
-func NewMetadataService(listener net.Listener, creds CredentialsSource) (MetadataService, error) {
+func NewMetadataService(listener net.Listener, creds CredentialsSource, config Config, identity *instanceIdentity) (MetadataService, error) {
 	return &metadataService{
 		listener: listener,
 		creds:    creds,
+		config:   config,
+		tokens:   newTokenStore(),
+		identity: identity,
+		started:  time.Now(),
 	}, nil
 }
 
@@ -167,3 +543,34 @@ type securityCredentialsResponse struct {
 	Token           string `json:"Token"`
 	Expiration      string `json:"Expiration"`
 }
+
+/*
+Structure encoded as JSON for the instance identity document.
+*/
+type identityDocument struct {
+	AccountID               string   `json:"accountId"`
+	Architecture            string   `json:"architecture"`
+	AvailabilityZone        string   `json:"availabilityZone"`
+	BillingProducts         []string `json:"billingProducts"`
+	DevpayProductCodes      []string `json:"devpayProductCodes"`
+	MarketplaceProductCodes []string `json:"marketplaceProductCodes"`
+	ImageID                 string   `json:"imageId"`
+	InstanceID              string   `json:"instanceId"`
+	InstanceType            string   `json:"instanceType"`
+	KernelID                *string  `json:"kernelId"`
+	PendingTime             string   `json:"pendingTime"`
+	PrivateIP               string   `json:"privateIp"`
+	RamdiskID               *string  `json:"ramdiskId"`
+	Region                  string   `json:"region"`
+	Version                 string   `json:"version"`
+}
+
+/*
+Structure encoded as JSON for the iam/info category.
+*/
+type iamInfoResponse struct {
+	Code               string `json:"Code"`
+	LastUpdated        string `json:"LastUpdated"`
+	InstanceProfileArn string `json:"InstanceProfileArn"`
+	InstanceProfileID  string `json:"InstanceProfileId"`
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers and limits used by the IMDSv2 session token protocol
+const (
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	imdsTokenMinTTL    = 1
+	imdsTokenMaxTTL    = 21600
+	imdsTokenPath      = "/latest/api/token"
+)
+
+/*
+tokenStore keeps track of the IMDSv2 session tokens handed out by the
+metadata service and when they expire.
+*/
+type tokenStore struct {
+	lock   sync.Mutex
+	tokens map[string]time.Time
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{
+		tokens: make(map[string]time.Time),
+	}
+}
+
+/*
+issue creates a new token that is valid for ttl. Expired tokens are purged
+from the store as a side effect.
+*/
+func (s *tokenStore) issue(ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for t, expires := range s.tokens {
+		if expires.Before(now) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = now.Add(ttl)
+
+	return token, nil
+}
+
+// valid returns true if the token has been issued and has not yet expired
+func (s *tokenStore) valid(token string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	expires, ok := s.tokens[token]
+	if !ok {
+		return false
+	}
+
+	if expires.Before(time.Now()) {
+		delete(s.tokens, token)
+		return false
+	}
+
+	return true
+}
+
+// randomToken returns a random, URL safe, string suitable as a secret token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+/*
+putToken handles `PUT /latest/api/token` and issues a session token valid for
+the number of seconds given in the TTL header.
+*/
+func (mds *metadataService) putToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The EC2 metadata service refuses token requests that have passed through
+	// a proxy, mimic that to not hand out tokens to forwarded requests.
+	if r.Header.Get("X-Forwarded-For") != "" {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+	if err != nil || ttl < imdsTokenMinTTL || ttl > imdsTokenMaxTTL {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	token, err := mds.tokens.issue(time.Duration(ttl) * time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+	fmt.Fprint(w, token)
+}
+
+/*
+checkToken validates the session token on every metadata request. Requests
+without a token are only accepted when IMDSv1 is allowed by the configuration.
+*/
+func (mds *metadataService) checkToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == imdsTokenPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(imdsTokenHeader)
+		if token == "" && !mds.config.RequireIMDSv2 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !mds.tokens.valid(token) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned when an MFA token is given for a request that is not pending
+var (
+	errNoMFARequest      = fmt.Errorf("no such MFA request")
+	errMFARequestDropped = fmt.Errorf("MFA request dropped, another profile has been assumed")
+)
+
+// askpassRetryInterval is how long a failed mfa_askpass request stays pending before it is asked again
+const askpassRetryInterval = time.Minute
+
+// mfaRequest is an MFA token the service needs to renew the credentials of Profile
+type mfaRequest struct {
+	ID      int64
+	Profile string
+	Serial  string
+	Created time.Time
+}
+
+/*
+mfaQueue holds the MFA tokens the service is waiting for, to renew credentials
+in the background. There is at most one pending request per profile. Requests
+are answered with `limes mfa`, or by the mfa_askpass program.
+*/
+type mfaQueue struct {
+	lock    sync.Mutex
+	next    int64
+	pending map[string]*mfaRequest
+}
+
+// add queues a request for profile, the request is returned with true if it is new
+func (q *mfaQueue) add(profile, serial string) (mfaRequest, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if req, ok := q.pending[profile]; ok {
+		return *req, false
+	}
+
+	q.next++
+	req := &mfaRequest{
+		ID:      q.next,
+		Profile: profile,
+		Serial:  serial,
+		Created: time.Now(),
+	}
+	if q.pending == nil {
+		q.pending = make(map[string]*mfaRequest)
+	}
+	q.pending[profile] = req
+
+	return *req, true
+}
+
+// get returns the pending request id
+func (q *mfaQueue) get(id int64) (mfaRequest, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, req := range q.pending {
+		if req.ID == id {
+			return *req, true
+		}
+	}
+	return mfaRequest{}, false
+}
+
+// isPending returns true if there is a request for profile
+func (q *mfaQueue) isPending(profile string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	_, ok := q.pending[profile]
+	return ok
+}
+
+// done removes the request for profile, if any
+func (q *mfaQueue) done(profile string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.pending, profile)
+}
+
+// remove removes the request id, if it is still pending
+func (q *mfaQueue) remove(id int64) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for profile, req := range q.pending {
+		if req.ID == id {
+			delete(q.pending, profile)
+		}
+	}
+}
+
+// forget drops all pending requests
+func (q *mfaQueue) forget() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.pending = nil
+}
+
+// list returns the pending requests, oldest first
+func (q *mfaQueue) list() []mfaRequest {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	res := make([]mfaRequest, 0, len(q.pending))
+	for _, req := range q.pending {
+		res = append(res, *req)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	return res
+}
+
+/*
+askpass runs the program askpass to get the MFA token for req, in the same way
+as SSH_ASKPASS: the prompt is the only argument and the token is read from
+the output of the program. The profile and MFA serial are also passed in the
+environment, as LIMES_MFA_PROFILE and LIMES_MFA_SERIAL.
+*/
+func askpass(askpass string, req mfaRequest) (string, error) {
+	prompt := fmt.Sprintf("MFA token to renew the credentials of %v (%v):", req.Profile, req.Serial)
+
+	cmd := exec.Command(askpass, prompt)
+	cmd.Env = append(os.Environ(),
+		"LIMES_MFA_PROFILE="+req.Profile,
+		"LIMES_MFA_SERIAL="+req.Serial,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", askpass, err)
+	}
+
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("%v: no MFA token given", askpass)
+	}
+
+	return token, nil
+}
+
+// mfaSerial returns the MFA serial needed to assume the profile name
+func (p Profiles) mfaSerial(name string) string {
+	chain, err := p.sourceChain(name)
+	if err != nil {
+		return p[name].MFASerial
+	}
+
+	for _, profile := range chain {
+		if serial := p[profile].MFASerial; serial != "" {
+			return serial
+		}
+	}
+	return ""
+}
+
+/*
+requestMFA queues a request for the MFA token needed to renew the credentials
+of role. The mfa_askpass program is started for new requests, if configured.
+If it fails the request is removed after askpassRetryInterval, so that the next
+refresh asks again; until then it can be answered with `limes mfa`.
+*/
+func (m *CredentialsExpirationManager) requestMFA(role string) {
+	req, created := m.mfa.add(role, m.config.Profiles.mfaSerial(role))
+	if !created {
+		return
+	}
+
+	log.Printf("MFA needed to renew the credentials of %v, run 'limes mfa'", role)
+	if m.config.MFAAskpass == "" {
+		return
+	}
+
+	go func() {
+		token, err := askpass(m.config.MFAAskpass, req)
+		if err == nil {
+			err = m.AnswerMFA(req.ID, token)
+		}
+		if err == nil || err == errNoMFARequest || err == errMFARequestDropped {
+			return
+		}
+
+		log.Printf("Unable to renew the credentials of %v: %v", req.Profile, err)
+		time.AfterFunc(askpassRetryInterval, func() {
+			m.mfa.remove(req.ID)
+		})
+	}()
+}
+
+// PendingMFA returns the MFA tokens the service is waiting for
+func (m *CredentialsExpirationManager) PendingMFA() []mfaRequest {
+	return m.mfa.list()
+}
+
+/*
+AnswerMFA renews the credentials of the request id with the MFA token mfa. The
+request is dropped, and errMFARequestDropped returned, if another role has been
+assumed since it was made.
+*/
+func (m *CredentialsExpirationManager) AnswerMFA(id int64, mfa string) error {
+	req, ok := m.mfa.get(id)
+	if !ok {
+		return errNoMFARequest
+	}
+
+	if m.Role() != req.Profile {
+		m.mfa.remove(req.ID)
+		return errMFARequestDropped
+	}
+
+	return m.renew(req.Profile, mfa)
+}
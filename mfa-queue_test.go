@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestAnswerMFARoleChanged(t *testing.T) {
+	m := &CredentialsExpirationManager{role: "other"}
+	req, _ := m.mfa.add("default", "arn:aws:iam::123456789012:mfa/me")
+
+	if err := m.AnswerMFA(req.ID, "123456"); err != errMFARequestDropped {
+		t.Errorf("AnswerMFA = %v, want %v", err, errMFARequestDropped)
+	}
+	if m.mfa.isPending("default") {
+		t.Errorf("the request is still pending")
+	}
+	if err := m.AnswerMFA(req.ID, "123456"); err != errNoMFARequest {
+		t.Errorf("AnswerMFA = %v, want %v", err, errNoMFARequest)
+	}
+}
+
+func TestMFAQueueRemove(t *testing.T) {
+	q := mfaQueue{}
+	old, _ := q.add("default", "")
+	q.done("default")
+	current, _ := q.add("default", "")
+
+	q.remove(old.ID)
+	if !q.isPending("default") {
+		t.Errorf("removing an answered request dropped the new request")
+	}
+
+	q.remove(current.ID)
+	if q.isPending("default") {
+		t.Errorf("the request is still pending")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// previousProfile is the profile name that assumes the previous profile again
+const previousProfile = "-"
+
+// maxProfileStack is the number of previous profiles that are remembered
+const maxProfileStack = 10
+
+// errNoPreviousProfile is returned by `limes assume -` when no other profile has been assumed
+var errNoPreviousProfile = fmt.Errorf("No previous profile")
+
+// errProfileChanged is returned when a profile is not reverted, as another profile was assumed meanwhile
+var errProfileChanged = fmt.Errorf("The active profile changed")
+
+/*
+profileStack holds the profiles assumed before the active one, most recent
+last, and the timer that reverts a profile assumed with `limes assume --for`.
+*/
+type profileStack struct {
+	lock     sync.Mutex
+	profiles []string
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+// push remembers name as the previous profile
+func (s *profileStack) push(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.profiles = append(s.profiles, name)
+	if len(s.profiles) > maxProfileStack {
+		s.profiles = s.profiles[len(s.profiles)-maxProfileStack:]
+	}
+}
+
+// top returns the previous profile
+func (s *profileStack) top() (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.profiles) == 0 {
+		return "", false
+	}
+	return s.profiles[len(s.profiles)-1], true
+}
+
+// pop forgets the previous profile
+func (s *profileStack) pop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.profiles) > 0 {
+		s.profiles = s.profiles[:len(s.profiles)-1]
+	}
+}
+
+// list returns the previous profiles, most recent first
+func (s *profileStack) list() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := make([]string, 0, len(s.profiles))
+	for i := len(s.profiles) - 1; i >= 0; i-- {
+		res = append(res, s.profiles[i])
+	}
+	return res
+}
+
+// timebox calls revert after d, a pending revert is cancelled. A zero d only
+// cancels the pending revert.
+func (s *profileStack) timebox(d time.Duration, revert func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+		s.revertAt = time.Time{}
+	}
+
+	if d > 0 {
+		s.timer = time.AfterFunc(d, revert)
+		s.revertAt = time.Now().Add(d)
+	}
+}
+
+// reverting returns when the active profile is reverted, or the zero time
+func (s *profileStack) reverting() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.revertAt
+}
+
+// restore replaces the previous profiles with profiles, most recent first
+func (s *profileStack) restore(profiles []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.profiles = nil
+	for i := len(profiles) - 1; i >= 0; i-- {
+		s.profiles = append(s.profiles, profiles[i])
+	}
+	if len(s.profiles) > maxProfileStack {
+		s.profiles = s.profiles[len(s.profiles)-maxProfileStack:]
+	}
+}
+
+// forget drops the previous profiles and the pending revert
+func (s *profileStack) forget() {
+	s.timebox(0, nil)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.profiles = nil
+}
+
+/*
+SwitchRole assumes the role name, like AssumeRole, and remembers the active
+profile as the previous profile. The name "-" assumes the previous profile. If
+d is not zero the previous profile is assumed again after d.
+*/
+func (m *CredentialsExpirationManager) SwitchRole(name, mfa string, d time.Duration) error {
+	toggle := name == previousProfile
+	if toggle {
+		prev, ok := m.stack.top()
+		if !ok {
+			return errNoPreviousProfile
+		}
+		name = prev
+	}
+
+	current, err := m.assumeRole(name, mfa, nil)
+	if err != nil {
+		return err
+	}
+
+	if toggle {
+		m.stack.pop()
+	}
+	if current != "" && current != name {
+		m.stack.push(current)
+	}
+
+	m.stack.timebox(d, func() {
+		m.revert(name)
+	})
+	m.saveSessions()
+	return nil
+}
+
+/*
+revert assumes the previous profile again when the time of the profile name is
+up. If that fails the service is locked, so that the credentials of name are
+not served any longer.
+*/
+func (m *CredentialsExpirationManager) revert(name string) {
+	m.stack.timebox(0, nil)
+	if m.Role() != name {
+		return
+	}
+
+	prev, ok := m.stack.top()
+	if !ok {
+		log.Printf("Time is up for %v, no previous profile: locking", name)
+		m.Lock()
+		return
+	}
+
+	log.Printf("Time is up for %v, reverting to %v", name, prev)
+	_, err := m.assumeRole(prev, "", func(current string) bool {
+		return current == name
+	})
+	if err == errProfileChanged {
+		return
+	}
+	if err != nil {
+		if m.Role() == name {
+			log.Printf("Unable to revert to %v: %v, locking", prev, err)
+			m.Lock()
+		}
+		return
+	}
+	m.stack.pop()
+	m.saveSessions()
+}
+
+// ProfileStack returns the previous profiles, most recent first, and when the
+// active profile is reverted, or the zero time
+func (m *CredentialsExpirationManager) ProfileStack() ([]string, time.Time) {
+	return m.stack.list(), m.stack.reverting()
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestRevertAfterProfileChanged(t *testing.T) {
+	m := &CredentialsExpirationManager{role: "other"}
+	m.stack.push(profileDefault)
+
+	m.revert("prod")
+
+	if role := m.Role(); role != "other" {
+		t.Errorf("role = %v, want other", role)
+	}
+	if m.err != nil {
+		t.Errorf("the service was locked: %v", m.err)
+	}
+	if prev, _ := m.stack.top(); prev != profileDefault {
+		t.Errorf("previous profile = %v, want %v", prev, profileDefault)
+	}
+}
+
+func TestProfileStackRestore(t *testing.T) {
+	s := profileStack{}
+	s.push("a")
+	s.push("b")
+
+	restored := profileStack{}
+	restored.restore(s.list())
+
+	if prev, _ := restored.top(); prev != "b" {
+		t.Errorf("previous profile = %v, want b", prev)
+	}
+	restored.pop()
+	if prev, _ := restored.top(); prev != "a" {
+		t.Errorf("previous profile = %v, want a", prev)
+	}
+}
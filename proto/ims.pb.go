@@ -13,8 +13,19 @@ It has these top-level messages:
 	StatusReply
 	StopReply
 	AssumeRoleRequest
+	SessionPolicy
 	Profile
 	ConfigReply
+	CertificateReply
+	ContainerCredentialsReply
+	LoginRequest
+	LoginReply
+	UnlockRequest
+	Session
+	SessionsReply
+	MFARequest
+	PendingMFAReply
+	AnswerMFARequest
 */
 package ims
 
@@ -47,13 +58,15 @@ func (*Void) ProtoMessage()               {}
 func (*Void) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type StatusReply struct {
-	Error           string `protobuf:"bytes,1,opt,name=Error" json:"Error,omitempty"`
-	Role            string `protobuf:"bytes,2,opt,name=Role" json:"Role,omitempty"`
-	AccessKeyId     string `protobuf:"bytes,3,opt,name=AccessKeyId" json:"AccessKeyId,omitempty"`
-	SecretAccessKey string `protobuf:"bytes,4,opt,name=SecretAccessKey" json:"SecretAccessKey,omitempty"`
-	SessionToken    string `protobuf:"bytes,5,opt,name=SessionToken" json:"SessionToken,omitempty"`
-	Expiration      string `protobuf:"bytes,6,opt,name=Expiration" json:"Expiration,omitempty"`
-	Region          string `protobuf:"bytes,7,opt,name=Region" json:"Region,omitempty"`
+	Error           string   `protobuf:"bytes,1,opt,name=Error" json:"Error,omitempty"`
+	Role            string   `protobuf:"bytes,2,opt,name=Role" json:"Role,omitempty"`
+	AccessKeyId     string   `protobuf:"bytes,3,opt,name=AccessKeyId" json:"AccessKeyId,omitempty"`
+	SecretAccessKey string   `protobuf:"bytes,4,opt,name=SecretAccessKey" json:"SecretAccessKey,omitempty"`
+	SessionToken    string   `protobuf:"bytes,5,opt,name=SessionToken" json:"SessionToken,omitempty"`
+	Expiration      string   `protobuf:"bytes,6,opt,name=Expiration" json:"Expiration,omitempty"`
+	Region          string   `protobuf:"bytes,7,opt,name=Region" json:"Region,omitempty"`
+	Previous        []string `protobuf:"bytes,8,rep,name=Previous" json:"Previous,omitempty"`
+	RevertAt        string   `protobuf:"bytes,9,opt,name=RevertAt" json:"RevertAt,omitempty"`
 }
 
 func (m *StatusReply) Reset()                    { *m = StatusReply{} }
@@ -110,6 +123,20 @@ func (m *StatusReply) GetRegion() string {
 	return ""
 }
 
+func (m *StatusReply) GetPrevious() []string {
+	if m != nil {
+		return m.Previous
+	}
+	return nil
+}
+
+func (m *StatusReply) GetRevertAt() string {
+	if m != nil {
+		return m.RevertAt
+	}
+	return ""
+}
+
 type StopReply struct {
 	Error string `protobuf:"bytes,1,opt,name=Error" json:"Error,omitempty"`
 }
@@ -127,8 +154,10 @@ func (m *StopReply) GetError() string {
 }
 
 type AssumeRoleRequest struct {
-	Name string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
-	Mfa  string `protobuf:"bytes,2,opt,name=Mfa" json:"Mfa,omitempty"`
+	Name       string         `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Mfa        string         `protobuf:"bytes,2,opt,name=Mfa" json:"Mfa,omitempty"`
+	Policy     *SessionPolicy `protobuf:"bytes,3,opt,name=Policy" json:"Policy,omitempty"`
+	ForSeconds int64          `protobuf:"varint,4,opt,name=ForSeconds" json:"ForSeconds,omitempty"`
 }
 
 func (m *AssumeRoleRequest) Reset()                    { *m = AssumeRoleRequest{} }
@@ -150,6 +179,52 @@ func (m *AssumeRoleRequest) GetMfa() string {
 	return ""
 }
 
+func (m *AssumeRoleRequest) GetPolicy() *SessionPolicy {
+	if m != nil {
+		return m.Policy
+	}
+	return nil
+}
+
+func (m *AssumeRoleRequest) GetForSeconds() int64 {
+	if m != nil {
+		return m.ForSeconds
+	}
+	return 0
+}
+
+type SessionPolicy struct {
+	Policy     string   `protobuf:"bytes,1,opt,name=Policy" json:"Policy,omitempty"`
+	PolicyArns []string `protobuf:"bytes,2,rep,name=PolicyArns" json:"PolicyArns,omitempty"`
+	ReadOnly   bool     `protobuf:"varint,3,opt,name=ReadOnly" json:"ReadOnly,omitempty"`
+}
+
+func (m *SessionPolicy) Reset()                    { *m = SessionPolicy{} }
+func (m *SessionPolicy) String() string            { return proto.CompactTextString(m) }
+func (*SessionPolicy) ProtoMessage()               {}
+func (*SessionPolicy) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *SessionPolicy) GetPolicy() string {
+	if m != nil {
+		return m.Policy
+	}
+	return ""
+}
+
+func (m *SessionPolicy) GetPolicyArns() []string {
+	if m != nil {
+		return m.PolicyArns
+	}
+	return nil
+}
+
+func (m *SessionPolicy) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
 type Profile struct {
 	AwsAccessKeyID     string `protobuf:"bytes,1,opt,name=AwsAccessKeyID" json:"AwsAccessKeyID,omitempty"`
 	AwsSecretAccessKey string `protobuf:"bytes,2,opt,name=AwsSecretAccessKey" json:"AwsSecretAccessKey,omitempty"`
@@ -164,7 +239,7 @@ type Profile struct {
 func (m *Profile) Reset()                    { *m = Profile{} }
 func (m *Profile) String() string            { return proto.CompactTextString(m) }
 func (*Profile) ProtoMessage()               {}
-func (*Profile) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*Profile) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func (m *Profile) GetAwsAccessKeyID() string {
 	if m != nil {
@@ -229,7 +304,7 @@ type ConfigReply struct {
 func (m *ConfigReply) Reset()                    { *m = ConfigReply{} }
 func (m *ConfigReply) String() string            { return proto.CompactTextString(m) }
 func (*ConfigReply) ProtoMessage()               {}
-func (*ConfigReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ConfigReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
 func (m *ConfigReply) GetProfiles() map[string]*Profile {
 	if m != nil {
@@ -238,13 +313,256 @@ func (m *ConfigReply) GetProfiles() map[string]*Profile {
 	return nil
 }
 
+type CertificateReply struct {
+	Certificate string `protobuf:"bytes,1,opt,name=Certificate" json:"Certificate,omitempty"`
+}
+
+func (m *CertificateReply) Reset()                    { *m = CertificateReply{} }
+func (m *CertificateReply) String() string            { return proto.CompactTextString(m) }
+func (*CertificateReply) ProtoMessage()               {}
+func (*CertificateReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *CertificateReply) GetCertificate() string {
+	if m != nil {
+		return m.Certificate
+	}
+	return ""
+}
+
+type ContainerCredentialsReply struct {
+	FullURI            string `protobuf:"bytes,1,opt,name=FullURI" json:"FullURI,omitempty"`
+	AuthorizationToken string `protobuf:"bytes,2,opt,name=AuthorizationToken" json:"AuthorizationToken,omitempty"`
+}
+
+func (m *ContainerCredentialsReply) Reset()                    { *m = ContainerCredentialsReply{} }
+func (m *ContainerCredentialsReply) String() string            { return proto.CompactTextString(m) }
+func (*ContainerCredentialsReply) ProtoMessage()               {}
+func (*ContainerCredentialsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ContainerCredentialsReply) GetFullURI() string {
+	if m != nil {
+		return m.FullURI
+	}
+	return ""
+}
+
+func (m *ContainerCredentialsReply) GetAuthorizationToken() string {
+	if m != nil {
+		return m.AuthorizationToken
+	}
+	return ""
+}
+
+type LoginRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+}
+
+func (m *LoginRequest) Reset()                    { *m = LoginRequest{} }
+func (m *LoginRequest) String() string            { return proto.CompactTextString(m) }
+func (*LoginRequest) ProtoMessage()               {}
+func (*LoginRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *LoginRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type LoginReply struct {
+	VerificationURI         string `protobuf:"bytes,1,opt,name=VerificationURI" json:"VerificationURI,omitempty"`
+	VerificationURIComplete string `protobuf:"bytes,2,opt,name=VerificationURIComplete" json:"VerificationURIComplete,omitempty"`
+	UserCode                string `protobuf:"bytes,3,opt,name=UserCode" json:"UserCode,omitempty"`
+}
+
+func (m *LoginReply) Reset()                    { *m = LoginReply{} }
+func (m *LoginReply) String() string            { return proto.CompactTextString(m) }
+func (*LoginReply) ProtoMessage()               {}
+func (*LoginReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *LoginReply) GetVerificationURI() string {
+	if m != nil {
+		return m.VerificationURI
+	}
+	return ""
+}
+
+func (m *LoginReply) GetVerificationURIComplete() string {
+	if m != nil {
+		return m.VerificationURIComplete
+	}
+	return ""
+}
+
+func (m *LoginReply) GetUserCode() string {
+	if m != nil {
+		return m.UserCode
+	}
+	return ""
+}
+
+type UnlockRequest struct {
+	Passphrase string `protobuf:"bytes,1,opt,name=Passphrase" json:"Passphrase,omitempty"`
+}
+
+func (m *UnlockRequest) Reset()                    { *m = UnlockRequest{} }
+func (m *UnlockRequest) String() string            { return proto.CompactTextString(m) }
+func (*UnlockRequest) ProtoMessage()               {}
+func (*UnlockRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *UnlockRequest) GetPassphrase() string {
+	if m != nil {
+		return m.Passphrase
+	}
+	return ""
+}
+
+type Session struct {
+	Name       string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Kind       string `protobuf:"bytes,2,opt,name=Kind" json:"Kind,omitempty"`
+	Expiration string `protobuf:"bytes,3,opt,name=Expiration" json:"Expiration,omitempty"`
+}
+
+func (m *Session) Reset()                    { *m = Session{} }
+func (m *Session) String() string            { return proto.CompactTextString(m) }
+func (*Session) ProtoMessage()               {}
+func (*Session) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *Session) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Session) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *Session) GetExpiration() string {
+	if m != nil {
+		return m.Expiration
+	}
+	return ""
+}
+
+type SessionsReply struct {
+	Sessions []*Session `protobuf:"bytes,1,rep,name=Sessions" json:"Sessions,omitempty"`
+}
+
+func (m *SessionsReply) Reset()                    { *m = SessionsReply{} }
+func (m *SessionsReply) String() string            { return proto.CompactTextString(m) }
+func (*SessionsReply) ProtoMessage()               {}
+func (*SessionsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *SessionsReply) GetSessions() []*Session {
+	if m != nil {
+		return m.Sessions
+	}
+	return nil
+}
+
+type MFARequest struct {
+	Id      int64  `protobuf:"varint,1,opt,name=Id" json:"Id,omitempty"`
+	Profile string `protobuf:"bytes,2,opt,name=Profile" json:"Profile,omitempty"`
+	Serial  string `protobuf:"bytes,3,opt,name=Serial" json:"Serial,omitempty"`
+	Created string `protobuf:"bytes,4,opt,name=Created" json:"Created,omitempty"`
+}
+
+func (m *MFARequest) Reset()                    { *m = MFARequest{} }
+func (m *MFARequest) String() string            { return proto.CompactTextString(m) }
+func (*MFARequest) ProtoMessage()               {}
+func (*MFARequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *MFARequest) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *MFARequest) GetProfile() string {
+	if m != nil {
+		return m.Profile
+	}
+	return ""
+}
+
+func (m *MFARequest) GetSerial() string {
+	if m != nil {
+		return m.Serial
+	}
+	return ""
+}
+
+func (m *MFARequest) GetCreated() string {
+	if m != nil {
+		return m.Created
+	}
+	return ""
+}
+
+type PendingMFAReply struct {
+	Requests []*MFARequest `protobuf:"bytes,1,rep,name=Requests" json:"Requests,omitempty"`
+}
+
+func (m *PendingMFAReply) Reset()                    { *m = PendingMFAReply{} }
+func (m *PendingMFAReply) String() string            { return proto.CompactTextString(m) }
+func (*PendingMFAReply) ProtoMessage()               {}
+func (*PendingMFAReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *PendingMFAReply) GetRequests() []*MFARequest {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+type AnswerMFARequest struct {
+	Id  int64  `protobuf:"varint,1,opt,name=Id" json:"Id,omitempty"`
+	Mfa string `protobuf:"bytes,2,opt,name=Mfa" json:"Mfa,omitempty"`
+}
+
+func (m *AnswerMFARequest) Reset()                    { *m = AnswerMFARequest{} }
+func (m *AnswerMFARequest) String() string            { return proto.CompactTextString(m) }
+func (*AnswerMFARequest) ProtoMessage()               {}
+func (*AnswerMFARequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *AnswerMFARequest) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *AnswerMFARequest) GetMfa() string {
+	if m != nil {
+		return m.Mfa
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Void)(nil), "ims.Void")
 	proto.RegisterType((*StatusReply)(nil), "ims.StatusReply")
 	proto.RegisterType((*StopReply)(nil), "ims.StopReply")
 	proto.RegisterType((*AssumeRoleRequest)(nil), "ims.AssumeRoleRequest")
+	proto.RegisterType((*SessionPolicy)(nil), "ims.SessionPolicy")
 	proto.RegisterType((*Profile)(nil), "ims.Profile")
 	proto.RegisterType((*ConfigReply)(nil), "ims.ConfigReply")
+	proto.RegisterType((*CertificateReply)(nil), "ims.CertificateReply")
+	proto.RegisterType((*ContainerCredentialsReply)(nil), "ims.ContainerCredentialsReply")
+	proto.RegisterType((*LoginRequest)(nil), "ims.LoginRequest")
+	proto.RegisterType((*LoginReply)(nil), "ims.LoginReply")
+	proto.RegisterType((*UnlockRequest)(nil), "ims.UnlockRequest")
+	proto.RegisterType((*Session)(nil), "ims.Session")
+	proto.RegisterType((*SessionsReply)(nil), "ims.SessionsReply")
+	proto.RegisterType((*MFARequest)(nil), "ims.MFARequest")
+	proto.RegisterType((*PendingMFAReply)(nil), "ims.PendingMFAReply")
+	proto.RegisterType((*AnswerMFARequest)(nil), "ims.AnswerMFARequest")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -263,6 +581,16 @@ type InstanceMetaServiceClient interface {
 	AssumeRole(ctx context.Context, in *AssumeRoleRequest, opts ...grpc.CallOption) (*StatusReply, error)
 	RetrieveRole(ctx context.Context, in *AssumeRoleRequest, opts ...grpc.CallOption) (*StatusReply, error)
 	Config(ctx context.Context, in *Void, opts ...grpc.CallOption) (*ConfigReply, error)
+	Certificate(ctx context.Context, in *Void, opts ...grpc.CallOption) (*CertificateReply, error)
+	ContainerCredentials(ctx context.Context, in *Void, opts ...grpc.CallOption) (*ContainerCredentialsReply, error)
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (InstanceMetaService_LoginClient, error)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*Void, error)
+	ReloadConfig(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error)
+	Sessions(ctx context.Context, in *Void, opts ...grpc.CallOption) (*SessionsReply, error)
+	PendingMFA(ctx context.Context, in *Void, opts ...grpc.CallOption) (*PendingMFAReply, error)
+	AnswerMFA(ctx context.Context, in *AnswerMFARequest, opts ...grpc.CallOption) (*Void, error)
+	Lock(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error)
+	Logout(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error)
 }
 
 type instanceMetaServiceClient struct {
@@ -318,6 +646,119 @@ func (c *instanceMetaServiceClient) Config(ctx context.Context, in *Void, opts .
 	return out, nil
 }
 
+func (c *instanceMetaServiceClient) Certificate(ctx context.Context, in *Void, opts ...grpc.CallOption) (*CertificateReply, error) {
+	out := new(CertificateReply)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/Certificate", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) ContainerCredentials(ctx context.Context, in *Void, opts ...grpc.CallOption) (*ContainerCredentialsReply, error) {
+	out := new(ContainerCredentialsReply)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/ContainerCredentials", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (InstanceMetaService_LoginClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_InstanceMetaService_serviceDesc.Streams[0], c.cc, "/ims.InstanceMetaService/Login", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &instanceMetaServiceLoginClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type InstanceMetaService_LoginClient interface {
+	Recv() (*LoginReply, error)
+	grpc.ClientStream
+}
+
+type instanceMetaServiceLoginClient struct {
+	grpc.ClientStream
+}
+
+func (x *instanceMetaServiceLoginClient) Recv() (*LoginReply, error) {
+	m := new(LoginReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *instanceMetaServiceClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/Unlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) ReloadConfig(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/ReloadConfig", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) Sessions(ctx context.Context, in *Void, opts ...grpc.CallOption) (*SessionsReply, error) {
+	out := new(SessionsReply)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/Sessions", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) PendingMFA(ctx context.Context, in *Void, opts ...grpc.CallOption) (*PendingMFAReply, error) {
+	out := new(PendingMFAReply)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/PendingMFA", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) AnswerMFA(ctx context.Context, in *AnswerMFARequest, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/AnswerMFA", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) Lock(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/Lock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instanceMetaServiceClient) Logout(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := grpc.Invoke(ctx, "/ims.InstanceMetaService/Logout", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for InstanceMetaService service
 
 type InstanceMetaServiceServer interface {
@@ -326,6 +767,16 @@ type InstanceMetaServiceServer interface {
 	AssumeRole(context.Context, *AssumeRoleRequest) (*StatusReply, error)
 	RetrieveRole(context.Context, *AssumeRoleRequest) (*StatusReply, error)
 	Config(context.Context, *Void) (*ConfigReply, error)
+	Certificate(context.Context, *Void) (*CertificateReply, error)
+	ContainerCredentials(context.Context, *Void) (*ContainerCredentialsReply, error)
+	Login(*LoginRequest, InstanceMetaService_LoginServer) error
+	Unlock(context.Context, *UnlockRequest) (*Void, error)
+	ReloadConfig(context.Context, *Void) (*Void, error)
+	Sessions(context.Context, *Void) (*SessionsReply, error)
+	PendingMFA(context.Context, *Void) (*PendingMFAReply, error)
+	AnswerMFA(context.Context, *AnswerMFARequest) (*Void, error)
+	Lock(context.Context, *Void) (*Void, error)
+	Logout(context.Context, *Void) (*Void, error)
 }
 
 func RegisterInstanceMetaServiceServer(s *grpc.Server, srv InstanceMetaServiceServer) {
@@ -422,6 +873,189 @@ func _InstanceMetaService_Config_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _InstanceMetaService_Certificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).Certificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/Certificate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).Certificate(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_ContainerCredentials_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).ContainerCredentials(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/ContainerCredentials",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).ContainerCredentials(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_Login_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LoginRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InstanceMetaServiceServer).Login(m, &instanceMetaServiceLoginServer{stream})
+}
+
+type InstanceMetaService_LoginServer interface {
+	Send(*LoginReply) error
+	grpc.ServerStream
+}
+
+type instanceMetaServiceLoginServer struct {
+	grpc.ServerStream
+}
+
+func (x *instanceMetaServiceLoginServer) Send(m *LoginReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _InstanceMetaService_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/Unlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).Unlock(ctx, req.(*UnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/ReloadConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).ReloadConfig(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_Sessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).Sessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/Sessions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).Sessions(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_PendingMFA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).PendingMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/PendingMFA",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).PendingMFA(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_AnswerMFA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnswerMFARequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).AnswerMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/AnswerMFA",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).AnswerMFA(ctx, req.(*AnswerMFARequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/Lock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).Lock(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InstanceMetaService_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InstanceMetaServiceServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ims.InstanceMetaService/Logout",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InstanceMetaServiceServer).Logout(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _InstanceMetaService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "ims.InstanceMetaService",
 	HandlerType: (*InstanceMetaServiceServer)(nil),
@@ -446,46 +1080,118 @@ var _InstanceMetaService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Config",
 			Handler:    _InstanceMetaService_Config_Handler,
 		},
+		{
+			MethodName: "Certificate",
+			Handler:    _InstanceMetaService_Certificate_Handler,
+		},
+		{
+			MethodName: "ContainerCredentials",
+			Handler:    _InstanceMetaService_ContainerCredentials_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _InstanceMetaService_Unlock_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _InstanceMetaService_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "Sessions",
+			Handler:    _InstanceMetaService_Sessions_Handler,
+		},
+		{
+			MethodName: "PendingMFA",
+			Handler:    _InstanceMetaService_PendingMFA_Handler,
+		},
+		{
+			MethodName: "AnswerMFA",
+			Handler:    _InstanceMetaService_AnswerMFA_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _InstanceMetaService_Lock_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _InstanceMetaService_Logout_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Login",
+			Handler:       _InstanceMetaService_Login_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "ims.proto",
 }
 
 func init() { proto.RegisterFile("ims.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 516 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x94, 0xcf, 0x6e, 0xd3, 0x4e,
-	0x10, 0xc7, 0xe3, 0xfc, 0x71, 0x9a, 0x49, 0xda, 0x5f, 0x7f, 0x03, 0xaa, 0xac, 0x0a, 0x55, 0x61,
-	0x41, 0x34, 0xa7, 0x1c, 0xc2, 0xa5, 0xe4, 0x66, 0x20, 0x48, 0x11, 0x4a, 0x85, 0x6c, 0xc4, 0xdd,
-	0xb8, 0x93, 0x6a, 0xd5, 0xc4, 0x1b, 0x76, 0x37, 0x29, 0xb9, 0xf2, 0x0c, 0x3c, 0x01, 0x57, 0x1e,
-	0x8a, 0x57, 0x41, 0xfb, 0x87, 0xc6, 0x71, 0x2b, 0x24, 0x6e, 0xb3, 0xdf, 0xf9, 0xce, 0x64, 0xe7,
-	0xe3, 0xd9, 0x40, 0x87, 0x2f, 0xd5, 0x70, 0x25, 0x85, 0x16, 0xd8, 0xe0, 0x4b, 0xc5, 0x42, 0x68,
-	0x7e, 0x12, 0xfc, 0x8a, 0xfd, 0x0a, 0xa0, 0x9b, 0xea, 0x4c, 0xaf, 0x55, 0x42, 0xab, 0xc5, 0x16,
-	0x1f, 0x43, 0x6b, 0x22, 0xa5, 0x90, 0x51, 0xd0, 0x0f, 0x06, 0x9d, 0xc4, 0x1d, 0x10, 0xa1, 0x99,
-	0x88, 0x05, 0x45, 0x75, 0x2b, 0xda, 0x18, 0xfb, 0xd0, 0x8d, 0xf3, 0x9c, 0x94, 0x7a, 0x4f, 0xdb,
-	0xe9, 0x55, 0xd4, 0xb0, 0xa9, 0xb2, 0x84, 0x03, 0xf8, 0x2f, 0xa5, 0x5c, 0x92, 0xbe, 0x13, 0xa3,
-	0xa6, 0x75, 0x55, 0x65, 0x64, 0xd0, 0x4b, 0x49, 0x29, 0x2e, 0x8a, 0x8f, 0xe2, 0x86, 0x8a, 0xa8,
-	0x65, 0x6d, 0x7b, 0x1a, 0x9e, 0x01, 0x4c, 0xbe, 0xae, 0xb8, 0xcc, 0x34, 0x17, 0x45, 0x14, 0x5a,
-	0x47, 0x49, 0xc1, 0x13, 0x08, 0x13, 0xba, 0x36, 0xb9, 0xb6, 0xcd, 0xf9, 0x13, 0x7b, 0x0a, 0x9d,
-	0x54, 0x8b, 0xd5, 0x5f, 0xc6, 0x63, 0xaf, 0xe0, 0xff, 0x58, 0xa9, 0xf5, 0x92, 0xcc, 0x60, 0x09,
-	0x7d, 0x59, 0x93, 0xd2, 0x66, 0xe6, 0xcb, 0x6c, 0x49, 0xde, 0x69, 0x63, 0x3c, 0x86, 0xc6, 0x6c,
-	0x9e, 0x79, 0x0c, 0x26, 0x64, 0x3f, 0xeb, 0xd0, 0xfe, 0x20, 0xc5, 0x9c, 0x2f, 0x08, 0x5f, 0xc0,
-	0x51, 0x7c, 0xab, 0x76, 0x04, 0xde, 0xfa, 0xda, 0x8a, 0x8a, 0x43, 0xc0, 0xf8, 0x56, 0x55, 0xd1,
-	0xb8, 0xa6, 0x0f, 0x64, 0x0c, 0x47, 0xab, 0x96, 0x00, 0x39, 0xda, 0x55, 0xb9, 0xc4, 0xa0, 0x59,
-	0x66, 0x80, 0x4f, 0xa0, 0x33, 0x7b, 0x17, 0xa7, 0x24, 0x79, 0xb6, 0xf0, 0x70, 0x77, 0x02, 0x46,
-	0xd0, 0x36, 0x83, 0xc7, 0xc9, 0xa5, 0xc7, 0xfa, 0xe7, 0x88, 0xcf, 0xe1, 0x30, 0x15, 0x6b, 0x99,
-	0x93, 0x1f, 0xd1, 0xa3, 0xdd, 0x17, 0xcd, 0xfd, 0x4c, 0x81, 0xbf, 0x89, 0x85, 0x76, 0xe0, 0xee,
-	0x57, 0x91, 0xd9, 0xf7, 0x00, 0xba, 0x6f, 0x44, 0x31, 0xe7, 0xd7, 0xee, 0x73, 0x8c, 0xe1, 0x60,
-	0xe5, 0x9a, 0xa8, 0x28, 0xe8, 0x37, 0x06, 0xdd, 0xd1, 0xd9, 0xd0, 0x2c, 0x6a, 0xc9, 0x33, 0xf4,
-	0xbf, 0xa2, 0x26, 0x85, 0x96, 0xdb, 0xe4, 0xce, 0x7f, 0x3a, 0x85, 0xc3, 0xbd, 0x94, 0xf9, 0x38,
-	0x37, 0xb4, 0xf5, 0xcc, 0x4d, 0x88, 0x0c, 0x5a, 0x9b, 0x6c, 0xb1, 0x76, 0x7b, 0xdb, 0x1d, 0xf5,
-	0x6c, 0x6f, 0x5f, 0x94, 0xb8, 0xd4, 0xb8, 0x7e, 0x11, 0x8c, 0xbe, 0xd5, 0xe1, 0xd1, 0xb4, 0x50,
-	0x3a, 0x2b, 0x72, 0x9a, 0x91, 0xce, 0x52, 0x92, 0x1b, 0x9e, 0x13, 0x9e, 0x43, 0xe8, 0xde, 0x06,
-	0x76, 0x6c, 0xa9, 0x79, 0x31, 0xa7, 0xc7, 0x36, 0x2c, 0xbd, 0x19, 0x56, 0xc3, 0x67, 0xd0, 0x34,
-	0x3b, 0x56, 0xb6, 0x1d, 0x79, 0x9b, 0xdf, 0x3c, 0x56, 0xc3, 0x0b, 0x80, 0xdd, 0x96, 0xe1, 0x89,
-	0xcd, 0xdf, 0x5b, 0xbb, 0x07, 0xdb, 0x8f, 0xa1, 0x97, 0x90, 0x96, 0x9c, 0x36, 0xff, 0x5e, 0x7b,
-	0x0e, 0xa1, 0xa3, 0x79, 0x7f, 0x86, 0x12, 0x65, 0x56, 0x7b, 0x1d, 0xfe, 0xa8, 0x37, 0xa6, 0xb3,
-	0xf4, 0x73, 0x68, 0xff, 0x25, 0x5e, 0xfe, 0x0e, 0x00, 0x00, 0xff, 0xff, 0xd9, 0x19, 0xc9, 0x8c,
-	0x32, 0x04, 0x00, 0x00,
+	// 1007 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0x49, 0x6f, 0x24, 0x35,
+	0x14, 0xee, 0x2d, 0x95, 0xee, 0xd7, 0xd9, 0xc6, 0x84, 0xa1, 0x88, 0x50, 0xd4, 0x18, 0x34, 0x13,
+	0x18, 0x29, 0x03, 0x81, 0x43, 0xc8, 0x01, 0xa9, 0x69, 0x12, 0xa9, 0x35, 0xc9, 0x10, 0xaa, 0xc9,
+	0xdc, 0x8b, 0xaa, 0x97, 0xc4, 0x4a, 0xc5, 0x6e, 0x6c, 0x77, 0x42, 0xb8, 0x73, 0xe3, 0x88, 0xc4,
+	0x9d, 0x2b, 0x3f, 0x86, 0xbf, 0x84, 0xbc, 0x54, 0xb5, 0xbb, 0xb2, 0x48, 0xdc, 0xfc, 0xbe, 0xf7,
+	0xd9, 0xfe, 0xea, 0x6d, 0x2e, 0xe8, 0xb1, 0x6b, 0xb5, 0x3b, 0x95, 0x42, 0x0b, 0xd2, 0x66, 0xd7,
+	0x8a, 0x46, 0xd0, 0x79, 0x27, 0x58, 0x4e, 0xff, 0x6a, 0x41, 0x7f, 0xa2, 0x53, 0x3d, 0x53, 0x09,
+	0x4e, 0x8b, 0x3b, 0xb2, 0x09, 0x4b, 0x87, 0x52, 0x0a, 0x19, 0x37, 0x07, 0xcd, 0x9d, 0x5e, 0xe2,
+	0x0c, 0x42, 0xa0, 0x93, 0x88, 0x02, 0xe3, 0x96, 0x05, 0xed, 0x9a, 0x0c, 0xa0, 0x3f, 0xcc, 0x32,
+	0x54, 0xea, 0x0d, 0xde, 0x8d, 0xf3, 0xb8, 0x6d, 0x5d, 0x21, 0x44, 0x76, 0x60, 0x7d, 0x82, 0x99,
+	0x44, 0x5d, 0x81, 0x71, 0xc7, 0xb2, 0xea, 0x30, 0xa1, 0xb0, 0x32, 0x41, 0xa5, 0x98, 0xe0, 0x3f,
+	0x89, 0x2b, 0xe4, 0xf1, 0x92, 0xa5, 0x2d, 0x60, 0x64, 0x1b, 0xe0, 0xf0, 0xd7, 0x29, 0x93, 0xa9,
+	0x66, 0x82, 0xc7, 0x91, 0x65, 0x04, 0x08, 0x79, 0x0e, 0x51, 0x82, 0x17, 0xc6, 0xb7, 0x6c, 0x7d,
+	0xde, 0x22, 0x5b, 0xd0, 0x3d, 0x95, 0x78, 0xc3, 0xc4, 0x4c, 0xc5, 0xdd, 0x41, 0x7b, 0xa7, 0x97,
+	0x54, 0xb6, 0xf1, 0x25, 0x78, 0x83, 0x52, 0x0f, 0x75, 0xdc, 0xb3, 0xbb, 0x2a, 0x9b, 0x7e, 0x0c,
+	0xbd, 0x89, 0x16, 0xd3, 0x27, 0xc2, 0x42, 0x7f, 0x6f, 0xc2, 0xb3, 0xa1, 0x52, 0xb3, 0x6b, 0x34,
+	0x11, 0x49, 0xf0, 0x97, 0x19, 0x2a, 0x6d, 0x82, 0xf5, 0x36, 0xbd, 0x46, 0x4f, 0xb5, 0x6b, 0xb2,
+	0x01, 0xed, 0x93, 0xf3, 0xd4, 0xc7, 0xcf, 0x2c, 0xc9, 0xe7, 0x10, 0x9d, 0x8a, 0x82, 0x65, 0x77,
+	0x36, 0x72, 0xfd, 0x3d, 0xb2, 0x6b, 0x32, 0xe4, 0xbf, 0xd8, 0x79, 0x12, 0xcf, 0x30, 0x9f, 0x7e,
+	0x24, 0xe4, 0x04, 0x33, 0xc1, 0x73, 0x65, 0x63, 0xd8, 0x4e, 0x02, 0x84, 0x66, 0xb0, 0xba, 0xb0,
+	0xd1, 0xc4, 0xc2, 0x1f, 0xee, 0x44, 0x04, 0x07, 0xb9, 0xd5, 0x50, 0x72, 0x15, 0xb7, 0x6c, 0x34,
+	0x02, 0xc4, 0xc5, 0x23, 0xcd, 0x7f, 0xe0, 0x85, 0x93, 0xd5, 0x4d, 0x2a, 0x9b, 0xfe, 0xd3, 0x82,
+	0xe5, 0x53, 0x29, 0xce, 0x59, 0x81, 0xe4, 0x05, 0xac, 0x0d, 0x6f, 0xd5, 0x3c, 0xd7, 0xdf, 0xfb,
+	0x7b, 0x6a, 0x28, 0xd9, 0x05, 0x32, 0xbc, 0x55, 0xf5, 0x22, 0x70, 0x51, 0x78, 0xc0, 0x63, 0x2a,
+	0xc6, 0xa2, 0x41, 0x29, 0xb8, 0xba, 0xaa, 0xc3, 0x41, 0xb6, 0x3b, 0x0b, 0xd9, 0xfe, 0x08, 0x7a,
+	0x27, 0x47, 0xc3, 0x09, 0x4a, 0x96, 0x16, 0xbe, 0x8c, 0xe6, 0x00, 0x89, 0x61, 0xd9, 0x64, 0x6a,
+	0x98, 0xbc, 0xf5, 0x05, 0x54, 0x9a, 0xe4, 0x53, 0x58, 0x9d, 0x88, 0x99, 0xcc, 0xd0, 0x7f, 0xa2,
+	0x2f, 0xa2, 0x45, 0xd0, 0xe8, 0x33, 0x1b, 0xbc, 0x12, 0x9b, 0xe5, 0xae, 0xd3, 0x57, 0x83, 0xe9,
+	0x9f, 0x4d, 0xe8, 0x8f, 0x04, 0x3f, 0x67, 0x17, 0xae, 0x80, 0x0e, 0xa0, 0x3b, 0x75, 0x87, 0xa8,
+	0xb8, 0x39, 0x68, 0xef, 0xf4, 0xf7, 0xb6, 0x6d, 0xc2, 0x03, 0xce, 0xae, 0xbf, 0x45, 0x1d, 0x72,
+	0x2d, 0xef, 0x92, 0x8a, 0xbf, 0x35, 0x86, 0xd5, 0x05, 0x97, 0xa9, 0xa6, 0x2b, 0x2c, 0x73, 0x6b,
+	0x96, 0x84, 0xc2, 0xd2, 0x4d, 0x5a, 0xcc, 0x5c, 0x87, 0xf6, 0xf7, 0x56, 0xec, 0xd9, 0x7e, 0x53,
+	0xe2, 0x5c, 0x07, 0xad, 0xfd, 0x26, 0xfd, 0x1a, 0x36, 0x46, 0x28, 0x35, 0x3b, 0x67, 0x59, 0xaa,
+	0xd1, 0x49, 0x1b, 0x40, 0x3f, 0xc0, 0xfc, 0xa9, 0x21, 0x44, 0x11, 0x3e, 0x1c, 0x09, 0xae, 0x53,
+	0xc6, 0x51, 0x8e, 0x24, 0xe6, 0xc8, 0x35, 0x4b, 0x0b, 0x3f, 0x31, 0x62, 0x58, 0x3e, 0x9a, 0x15,
+	0xc5, 0x59, 0x32, 0xf6, 0x5b, 0x4b, 0xd3, 0x66, 0x7f, 0xa6, 0x2f, 0x85, 0x64, 0xbf, 0xa5, 0xba,
+	0xcc, 0x5c, 0x95, 0xfd, 0x7b, 0x1e, 0x4a, 0x61, 0xe5, 0x58, 0x5c, 0x30, 0xfe, 0x44, 0x23, 0xd1,
+	0x3f, 0x9a, 0x00, 0x9e, 0x64, 0x2e, 0xdf, 0x81, 0xf5, 0x77, 0x28, 0x9d, 0x4e, 0x26, 0xf8, 0x5c,
+	0x44, 0x1d, 0x26, 0xfb, 0xf0, 0x41, 0x0d, 0x1a, 0x89, 0xeb, 0x69, 0x81, 0xba, 0x9c, 0x6a, 0x8f,
+	0xb9, 0x4d, 0x53, 0x9c, 0x29, 0x94, 0x23, 0x91, 0xa3, 0xaf, 0xc6, 0xca, 0xa6, 0xaf, 0x61, 0xf5,
+	0x8c, 0x17, 0x22, 0xbb, 0x2a, 0x35, 0x9b, 0x0e, 0x4b, 0x95, 0x9a, 0x5e, 0xca, 0x54, 0x95, 0xca,
+	0x03, 0x84, 0xfe, 0x08, 0xcb, 0xbe, 0x4c, 0x1e, 0x9c, 0x13, 0x04, 0x3a, 0x6f, 0x18, 0xcf, 0xcb,
+	0x41, 0x6b, 0xd6, 0xb5, 0xc1, 0xd7, 0xae, 0x0f, 0x3e, 0xfa, 0x4d, 0xd5, 0xfd, 0xaa, 0x0c, 0x4a,
+	0xb7, 0x04, 0x7c, 0xad, 0xad, 0x84, 0xc3, 0x25, 0xa9, 0xbc, 0xf4, 0x12, 0xe0, 0xe4, 0x68, 0x58,
+	0x6a, 0x5f, 0x83, 0xd6, 0x38, 0xb7, 0x72, 0xda, 0x49, 0x6b, 0x9c, 0x9b, 0xcc, 0x96, 0xdd, 0xe0,
+	0xf4, 0x94, 0xa6, 0xe9, 0x3e, 0xdf, 0x62, 0x4e, 0x4e, 0x34, 0xef, 0xaf, 0x91, 0xc4, 0x54, 0x63,
+	0xee, 0xdb, 0xb2, 0x34, 0xe9, 0xb7, 0xb0, 0x7e, 0x8a, 0x3c, 0x67, 0xfc, 0xc2, 0x5e, 0x68, 0x64,
+	0xbe, 0x82, 0xae, 0xbf, 0xb9, 0x94, 0xb9, 0x6e, 0x65, 0xce, 0x15, 0x25, 0x15, 0xc1, 0x14, 0xee,
+	0x90, 0xab, 0x5b, 0x94, 0x4f, 0xe8, 0xbd, 0x37, 0x64, 0xf7, 0xfe, 0x5d, 0x82, 0xf7, 0xc6, 0x5c,
+	0xe9, 0x94, 0x67, 0x78, 0x82, 0x3a, 0x9d, 0xa0, 0xbc, 0x61, 0x19, 0x92, 0x97, 0x10, 0xb9, 0x47,
+	0x8f, 0xf4, 0xec, 0x95, 0xe6, 0x29, 0xdc, 0xda, 0x70, 0x41, 0x9a, 0x3f, 0x86, 0xb4, 0x41, 0x3e,
+	0x81, 0x8e, 0x79, 0x04, 0x42, 0xda, 0x9a, 0xa7, 0xf9, 0xa7, 0x81, 0x36, 0xc8, 0x3e, 0xc0, 0xfc,
+	0x15, 0x20, 0xcf, 0xad, 0xff, 0xde, 0xb3, 0xf0, 0xe0, 0xf1, 0x07, 0xb0, 0x92, 0xa0, 0x96, 0x0c,
+	0x6f, 0xfe, 0xff, 0xde, 0x97, 0x10, 0xb9, 0xe1, 0x71, 0xff, 0x1b, 0x82, 0xa1, 0x42, 0x1b, 0xe4,
+	0xcb, 0x85, 0xfe, 0x0e, 0xd9, 0xef, 0x3b, 0x76, 0x6d, 0x20, 0xd0, 0x06, 0x19, 0xc1, 0xe6, 0x43,
+	0x0d, 0x1f, 0xee, 0xad, 0xc6, 0xd7, 0xc3, 0x63, 0x81, 0x36, 0xc8, 0x6b, 0x58, 0xb2, 0x9d, 0x4a,
+	0x9e, 0x59, 0x6a, 0xd8, 0xda, 0x5b, 0xeb, 0x21, 0x64, 0xe9, 0x5f, 0x34, 0xc9, 0x67, 0x10, 0xb9,
+	0x66, 0x22, 0xee, 0x31, 0x5c, 0xe8, 0xac, 0xad, 0xf9, 0xdd, 0xb4, 0x41, 0x5e, 0x98, 0xc0, 0x15,
+	0x22, 0xcd, 0xef, 0x87, 0x60, 0x81, 0xf7, 0x6a, 0xde, 0x0a, 0x21, 0x67, 0xe1, 0xb1, 0x0d, 0x04,
+	0xc3, 0xbc, 0x46, 0x43, 0xfa, 0xa6, 0x5d, 0xd6, 0xea, 0xd7, 0x6e, 0xe8, 0x55, 0x45, 0x49, 0x5c,
+	0x30, 0xeb, 0x45, 0xba, 0x28, 0x67, 0x1b, 0x3a, 0xc7, 0xe6, 0xfb, 0x1e, 0x93, 0x3b, 0x80, 0xe8,
+	0x58, 0x5c, 0x88, 0x99, 0x7e, 0x8c, 0xf1, 0x5d, 0xf4, 0x77, 0xab, 0x3d, 0x3e, 0x99, 0xfc, 0x1c,
+	0xd9, 0x7f, 0xb9, 0xaf, 0xfe, 0x1b, 0x00, 0x5c, 0x6e, 0x66, 0x49, 0xd8, 0x09, 0x00, 0x00,
 }
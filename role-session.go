@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// defaultRoleSessionName is used when a profile has no role_session_name
+const defaultRoleSessionName = "limes"
+
+// Limits of the role sessions accepted by STS
+const (
+	minDurationSeconds        = 900
+	maxDurationSeconds        = 43200
+	maxSessionTokenSeconds    = 129600
+	maxChainedDurationSeconds = 3600
+	maxRoleSessionNameLength  = 64
+)
+
+// invalidSessionNameChars matches the characters not allowed in a role session name
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+/*
+roleSessionNameVars are the variables available in role_session_name
+templates, e.g. `{{.User}}@{{.Hostname}}`.
+*/
+type roleSessionNameVars struct {
+	// User is the name of the user running limes
+	User string
+	// Hostname is the name of the machine
+	Hostname string
+	// Profile is the name of the profile being assumed
+	Profile string
+	// SourceProfile is the name of the base profile
+	SourceProfile string
+}
+
+/*
+roleSessionName renders the role_session_name template tmpl for the profile
+name, assumed from the base profile source. Characters that are not allowed
+in session names are replaced with "-", and the name is cut to the maximum
+length. The defaultRoleSessionName is used if the result is empty.
+*/
+func roleSessionName(tmpl, name, source string) (string, error) {
+	t, err := template.New("role_session_name").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	vars := roleSessionNameVars{
+		Profile:       name,
+		SourceProfile: source,
+	}
+	if usr, err := user.Current(); err == nil {
+		vars.User = usr.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		vars.Hostname = hostname
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+
+	sessionName := invalidSessionNameChars.ReplaceAllString(buf.String(), "-")
+	if len(sessionName) > maxRoleSessionNameLength {
+		sessionName = sessionName[:maxRoleSessionNameLength]
+	}
+	if len(sessionName) < 2 {
+		return defaultRoleSessionName, nil
+	}
+
+	return sessionName, nil
+}
+
+// durationSeconds returns the duration_seconds of the profile, or nil to use the default of STS
+func (p Profile) durationSeconds() *int64 {
+	if p.DurationSeconds == 0 {
+		return nil
+	}
+	return aws.Int64(p.DurationSeconds)
+}
+
+/*
+maxDuration returns the longest duration_seconds STS accepts for the profile
+name. GetSessionToken sessions of base profiles last up to 36 hours, roles
+assumed with the credentials of another role are limited to one hour.
+*/
+func (p Profiles) maxDuration(name string) int64 {
+	chain, err := p.sourceChain(name)
+	if err != nil {
+		return maxDurationSeconds
+	}
+
+	base := p[chain[0]]
+	assumed := base.webIdentity() || base.saml() || base.sso()
+	switch {
+	case len(chain) == 1 && !assumed:
+		return maxSessionTokenSeconds
+	case len(chain) > 2 || (len(chain) == 2 && assumed):
+		return maxChainedDurationSeconds
+	}
+	return maxDurationSeconds
+}
+
+// checkRoleSessions returns an error if the session settings of a profile are invalid
+func (p Profiles) checkRoleSessions() error {
+	for _, name := range p.names() {
+		profile := p[name]
+
+		if max := p.maxDuration(name); profile.DurationSeconds != 0 && (profile.DurationSeconds < minDurationSeconds || profile.DurationSeconds > max) {
+			return fmt.Errorf("profile %v: duration_seconds must be between %v and %v", name, minDurationSeconds, max)
+		}
+
+		if _, err := roleSessionName(profile.RoleSessionName, name, name); err != nil {
+			return fmt.Errorf("profile %v: role_session_name: %v", name, err)
+		}
+
+		if profile.Policy != "" && !json.Valid([]byte(profile.Policy)) {
+			return fmt.Errorf("profile %v: policy is not valid JSON", name)
+		}
+
+		if chain, err := p.sourceChain(name); err == nil && len(chain) == 1 && !profile.sessionPolicy().empty() {
+			return fmt.Errorf("profile %v: %v", name, errPolicyWithoutRole)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Settings of the encrypted session cache
+const (
+	sessionCacheFilePath   = ".limes/sessions"
+	sessionCacheKeyPath    = ".limes/sessions.key"
+	sessionCacheVersion    = 1
+	sessionCacheKeySize    = 32
+	sessionCacheAdditional = "limes sessions v1"
+)
+
+/*
+sessionCacheFile is the on disk format of the session cache. The sessions are
+encrypted with AES-256-GCM, using a random key kept in a separate file that
+only the user can read. The user and machine are part of the additional data,
+so a copy of the files does not decrypt for another user.
+*/
+type sessionCacheFile struct {
+	Version int    `json:"version"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// sessionCacheData are the sessions of the credentials manager kept on disk
+type sessionCacheData struct {
+	Role        string                   `json:"role"`
+	Credentials *sts.Credentials         `json:"credentials"`
+	Sessions    map[string]cachedSession `json:"sessions"`
+	Previous    []string                 `json:"previous,omitempty"`
+	RevertAt    *time.Time               `json:"revert_at,omitempty"`
+}
+
+// cachedSession is a base profile session in the session cache
+type cachedSession struct {
+	Credentials *sts.Credentials            `json:"credentials"`
+	Hops        map[string]*sts.Credentials `json:"hops"`
+}
+
+/*
+sessionCache persists the sessions of the credentials manager, so that they
+survive a restart of the service.
+*/
+type sessionCache struct {
+	lock    sync.Mutex
+	path    string
+	keyPath string
+}
+
+// newSessionCache returns the session cache in the home directory of the user
+func newSessionCache() (*sessionCache, error) {
+	home, err := homeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionCache{
+		path:    filepath.Join(home, sessionCacheFilePath),
+		keyPath: filepath.Join(home, sessionCacheKeyPath),
+	}, nil
+}
+
+// sessionCacheAdditionalData binds the cache to the user and the machine
+func sessionCacheAdditionalData() []byte {
+	additional := sessionCacheAdditional
+	if usr, err := user.Current(); err == nil {
+		additional += "\x00" + usr.Uid + "\x00" + usr.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		additional += "\x00" + hostname
+	}
+	return []byte(additional)
+}
+
+/*
+key reads the key of the cache, a new key is created if create is true and
+there is none. Keys that other users can read are not used.
+*/
+func (c *sessionCache) key(create bool) ([]byte, error) {
+	info, err := os.Stat(c.keyPath)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, sessionCacheKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(c.keyPath), 0700); err != nil {
+			return nil, err
+		}
+		return key, ioutil.WriteFile(c.keyPath, key, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%v is accessible by other users", c.keyPath)
+	}
+
+	key, err := ioutil.ReadFile(c.keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != sessionCacheKeySize {
+		return nil, fmt.Errorf("invalid key in %v", c.keyPath)
+	}
+	return key, nil
+}
+
+func sessionCacheCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// load decrypts the cached sessions, nil is returned if there are none
+func (c *sessionCache) load() (*sessionCacheData, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := sessionCacheFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", c.path, err)
+	}
+	if file.Version != sessionCacheVersion {
+		return nil, fmt.Errorf("unsupported session cache: version %v", file.Version)
+	}
+
+	key, err := c.key(false)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := sessionCacheCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, file.Nonce, file.Data, sessionCacheAdditionalData())
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt %v", c.path)
+	}
+
+	cache := &sessionCacheData{}
+	if err := json.Unmarshal(plain, cache); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", c.path, err)
+	}
+
+	return cache, nil
+}
+
+// save encrypts the sessions and writes them to the cache
+func (c *sessionCache) save(cache *sessionCacheData) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	plain, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	key, err := c.key(true)
+	if err != nil {
+		return err
+	}
+
+	aead, err := sessionCacheCipher(key)
+	if err != nil {
+		return err
+	}
+
+	file := sessionCacheFile{
+		Version: sessionCacheVersion,
+		Nonce:   make([]byte, aead.NonceSize()),
+	}
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, sessionCacheAdditionalData())
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// remove deletes the cache and its key
+func (c *sessionCache) remove() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, path := range []string{c.path, c.keyPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSessions writes the sessions, the active role and the previous profiles
+// to the session cache
+func (m *CredentialsExpirationManager) saveSessions() {
+	if m.cache == nil {
+		return
+	}
+
+	previous, revertAt := m.ProfileStack()
+
+	m.lock.Lock()
+	cache := &sessionCacheData{
+		Role:        m.role,
+		Credentials: m.credentials,
+		Sessions:    make(map[string]cachedSession),
+		Previous:    previous,
+	}
+	if !revertAt.IsZero() {
+		cache.RevertAt = &revertAt
+	}
+	for name, s := range m.sessions {
+		session := cachedSession{
+			Credentials: s.credentials,
+			Hops:        make(map[string]*sts.Credentials),
+		}
+		for hop, creds := range s.hops {
+			session.Hops[hop] = creds
+		}
+		cache.Sessions[name] = session
+	}
+	forgotten := m.err == errLocked || m.err == errLoggedOut
+	m.lock.Unlock()
+
+	if forgotten {
+		return
+	}
+
+	if err := m.cache.save(cache); err != nil {
+		log.Printf("Unable to save the session cache: %v", err)
+	}
+}
+
+/*
+restoreSessions loads the sessions of the base profiles from the session cache,
+and, if resume is true, resumes the role that was active when the service
+stopped with the previous profiles. A role assumed with `limes assume --for`
+is reverted again when its time is up, if that has passed already the
+previous profile is resumed instead. Sessions that have expired, or whose
+profile is no longer configured, are skipped. It returns true if a role was
+resumed.
+*/
+func (m *CredentialsExpirationManager) restoreSessions(resume bool) bool {
+	if m.cache == nil {
+		return false
+	}
+
+	cache, err := m.cache.load()
+	if err != nil {
+		log.Printf("Unable to load the session cache: %v", err)
+		return false
+	}
+	if cache == nil {
+		return false
+	}
+
+	m.lock.Lock()
+	for name, cached := range cache.Sessions {
+		profile, ok := m.config.Profiles[name]
+		if !ok || cached.Credentials == nil || cached.Credentials.Expiration == nil {
+			continue
+		}
+
+		s := &sourceSession{
+			name:        name,
+			profile:     profile,
+			credentials: cached.Credentials,
+			hops:        make(map[string]*sts.Credentials),
+		}
+		if s.expired() {
+			continue
+		}
+		for hop, creds := range cached.Hops {
+			if _, ok := m.config.Profiles[hop]; ok && creds != nil && creds.Expiration != nil {
+				s.hops[hop] = creds
+			}
+		}
+		s.client = s.stsClient(s.credentials)
+
+		log.Printf("Restored session for base profile: %v", name)
+		if m.sessions == nil {
+			m.sessions = make(map[string]*sourceSession)
+		}
+		m.sessions[name] = s
+	}
+	m.lock.Unlock()
+
+	if !resume {
+		return false
+	}
+
+	role, creds := cache.Role, cache.Credentials
+	m.stack.restore(cache.Previous)
+	if cache.RevertAt != nil && !time.Now().Before(*cache.RevertAt) {
+		// the time of the role is up, it is never resumed
+		prev, ok := m.stack.top()
+		if !ok {
+			log.Printf("Time is up for %v, not resuming it", role)
+			return false
+		}
+		log.Printf("Time is up for %v, resuming %v", role, prev)
+		m.stack.pop()
+		role, creds = prev, nil
+	}
+
+	if !m.resumeRole(role, creds) {
+		return false
+	}
+
+	if cache.RevertAt != nil && time.Now().Before(*cache.RevertAt) {
+		m.stack.timebox(time.Until(*cache.RevertAt), func() {
+			m.revert(role)
+		})
+	}
+	m.saveSessions()
+
+	return true
+}
+
+/*
+resumeRole makes role the active profile with its cached credentials creds. If
+they have expired the role is assumed again with the restored session of its
+base profile. It returns false if that is not possible without the user.
+*/
+func (m *CredentialsExpirationManager) resumeRole(role string, creds *sts.Credentials) bool {
+	chain, err := m.config.Profiles.sourceChain(role)
+	if err != nil {
+		return false
+	}
+
+	m.lock.Lock()
+	s, ok := m.sessions[chain[0]]
+	m.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	if creds == nil || creds.Expiration == nil || !time.Now().Before(*creds.Expiration) {
+		// the session of the base profile is still valid, assume the role again
+		if len(chain) == 1 {
+			creds = s.credentials
+		} else if err := m.AssumeRole(role, ""); err != nil {
+			log.Printf("Unable to resume %v: %v", role, err)
+			return false
+		} else {
+			return true
+		}
+	}
+
+	log.Printf("Resuming profile: %v", role)
+	m.lock.Lock()
+	m.source = s
+	m.lock.Unlock()
+	m.setCredentials(creds, role)
+
+	return true
+}
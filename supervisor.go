@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// awsConflictingEnv are variables that conflicts with the credentials limes
+// provides, they are removed from the environment of processes started by limes
+var awsConflictingEnv = map[string]bool{
+	"AWS_ACCESS_KEY_ID":                      true,
+	"AWS_SECRET_ACCESS_KEY":                  true,
+	"AWS_SESSION_TOKEN":                      true,
+	"AWS_SECURITY_TOKEN":                     true,
+	"AWS_CREDENTIAL_EXPIRATION":              true,
+	"AWS_PROFILE":                            true,
+	"AWS_DEFAULT_PROFILE":                    true,
+	"AWS_ROLE_ARN":                           true,
+	"AWS_ROLE_SESSION_NAME":                  true,
+	"AWS_WEB_IDENTITY_TOKEN_FILE":            true,
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI":     true,
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": true,
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN":      true,
+	"AWS_DEFAULT_REGION":                     true,
+	"AWS_REGION":                             true,
+}
+
+// cleanEnv are the variables kept in the environment when --clean-env is used
+var cleanEnv = map[string]bool{
+	"HOME":    true,
+	"LANG":    true,
+	"LOGNAME": true,
+	"PATH":    true,
+	"SHELL":   true,
+	"TERM":    true,
+	"TMPDIR":  true,
+	"TZ":      true,
+	"USER":    true,
+}
+
+/*
+commandEnv returns the environment for a process started by `limes run`, before
+the AWS variables are added. Conflicting AWS variables are removed and if clean
+is true only a minimal set of variables are kept. Variables from envFiles are
+added last.
+*/
+func commandEnv(clean bool, envFiles []string) ([]string, error) {
+	env := []string{}
+	for _, e := range os.Environ() {
+		key := strings.SplitN(e, "=", 2)[0]
+		if awsConflictingEnv[key] {
+			continue
+		}
+		if clean && !cleanEnv[key] {
+			continue
+		}
+		env = append(env, e)
+	}
+
+	for _, file := range envFiles {
+		vars, err := readEnvFile(file)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	}
+
+	return env, nil
+}
+
+/*
+readEnvFile reads KEY=VALUE pairs from path. Empty lines and lines starting with
+# are ignored, and an optional `export` prefix and quotes around the value are
+stripped.
+*/
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env := []string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, fmt.Errorf("%v:%v: expected KEY=VALUE", path, n)
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%v:%v: %v", path, n, err)
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	return env, scanner.Err()
+}
+
+/*
+exitCode returns the exit code to use for a process that exited with err. If the
+process was killed by a signal the exit code is 128 + signal, as in shells.
+*/
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		fmt.Fprintf(errout, "limes: %v\n", err)
+		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+			return 127
+		}
+		return 126
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1
+	}
+
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return status.ExitStatus()
+}
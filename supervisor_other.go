@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os/exec"
+
+// runSupervised runs command, signals are not forwarded on this platform
+func runSupervised(command *exec.Cmd) error {
+	return command.Run()
+}
@@ -0,0 +1,72 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+/*
+runSupervised runs command in a new process group and forwards SIGINT, SIGTERM
+and SIGHUP to the group until the command exits. If limes is in the foreground
+of a terminal the process group of command is moved to the foreground, so that
+it can read from the terminal and receives the signals from it.
+*/
+func runSupervised(command *exec.Cmd) error {
+	tty := int(os.Stdin.Fd())
+	foreground := isForeground(tty)
+
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Foreground: foreground,
+		Ctty:       tty,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	err := command.Start()
+	if err != nil {
+		return err
+	}
+	if foreground {
+		defer setForeground(tty, syscall.Getpgrp())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+
+	for {
+		select {
+		case sig := <-signals:
+			syscall.Kill(-command.Process.Pid, sig.(syscall.Signal))
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// isForeground returns true if fd is a terminal and limes is in its foreground process group
+func isForeground(fd int) bool {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
+
+// setForeground moves the process group pgrp to the foreground of the terminal fd
+func setForeground(fd int, pgrp int) {
+	// SIGTTOU is sent when a background process changes the foreground group
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	p := int32(pgrp)
+	syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&p)))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings of the TOTP codes of AWS virtual MFA devices (RFC 6238)
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+/*
+totpLastStep is the last time step a code was generated for, by MFA serial.
+AWS does not accept the same code twice, so a new code is waited for if the
+code of the current time step has already been used.
+*/
+var totpLastStep = struct {
+	sync.Mutex
+	steps map[string]int64
+}{steps: make(map[string]int64)}
+
+// totp returns the code of secret for the time step step
+func totp(secret []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, code%mod)
+}
+
+/*
+decodeTOTPSecret decodes a base32 TOTP seed. Spaces, lower case and missing
+padding are accepted, as is an otpauth:// URI with the seed in its secret
+parameter.
+*/
+func decodeTOTPSecret(seed string) ([]byte, error) {
+	seed = strings.TrimSpace(seed)
+
+	if strings.HasPrefix(seed, "otpauth://") {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return nil, err
+		}
+		seed = u.Query().Get("secret")
+	}
+
+	seed = strings.ToUpper(strings.Replace(seed, " ", "", -1))
+	seed = strings.TrimRight(seed, "=")
+	if seed == "" {
+		return nil, fmt.Errorf("empty TOTP seed")
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+}
+
+/*
+totpCode computes the current MFA token of the profile from the seed printed
+by mfa_totp_command.
+*/
+func (p Profile) totpCode() (string, error) {
+	seed, err := commandOutput(p.MFATOTPCommand)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := decodeTOTPSecret(seed)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP seed: %v", err)
+	}
+
+	step := nextTOTPStep(p.MFASerial, time.Now().Unix()/totpPeriod)
+	if wait := time.Until(time.Unix(step*totpPeriod, 0)); wait > 0 {
+		log.Printf("Waiting for the next TOTP code of %v", p.MFASerial)
+		time.Sleep(wait)
+	}
+
+	return totp(secret, step), nil
+}
+
+/*
+nextTOTPStep reserves the time step of the next code of serial, which is
+current unless a code has been generated for it already. The lock is not held
+while waiting for the step, so other serials are not blocked.
+*/
+func nextTOTPStep(serial string, current int64) int64 {
+	totpLastStep.Lock()
+	defer totpLastStep.Unlock()
+
+	step := current
+	if last := totpLastStep.steps[serial]; step <= last {
+		step = last + 1
+	}
+	totpLastStep.steps[serial] = step
+
+	return step
+}
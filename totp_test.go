@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// rfc6238Secret is the SHA-1 seed of the test vectors in RFC 6238
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTP(t *testing.T) {
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		if code := totp(rfc6238Secret, test.time/totpPeriod); code != test.code {
+			t.Errorf("totp(T=%v) = %v, want %v", test.time, code, test.code)
+		}
+	}
+}
+
+func TestDecodeTOTPSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		seed string
+	}{
+		{"upper case", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{"lower case", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq"},
+		{"spaces", "GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"},
+		{"newline", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ\n"},
+		{"otpauth", "otpauth://totp/AWS:me@123456789012?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=AWS"},
+	}
+
+	for _, test := range tests {
+		secret, err := decodeTOTPSecret(test.seed)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(secret, rfc6238Secret) {
+			t.Errorf("%v: secret = %q, want %q", test.name, secret, rfc6238Secret)
+		}
+	}
+}
+
+func TestDecodeTOTPSecretPadding(t *testing.T) {
+	// seeds whose length is not a multiple of 8 are padded in base32
+	tests := map[string]string{
+		"GEZDG":      "123",
+		"GEZDG===":   "123",
+		"gezdgnbv":   "12345",
+		"GEZDGNBVGY": "123456",
+	}
+
+	for seed, want := range tests {
+		secret, err := decodeTOTPSecret(seed)
+		if err != nil {
+			t.Errorf("%v: %v", seed, err)
+			continue
+		}
+		if string(secret) != want {
+			t.Errorf("%v: secret = %q, want %q", seed, secret, want)
+		}
+	}
+}
+
+func TestDecodeTOTPSecretInvalid(t *testing.T) {
+	for _, seed := range []string{"", "  ", "otpauth://totp/AWS:me", "GEZDG1"} {
+		if _, err := decodeTOTPSecret(seed); err == nil {
+			t.Errorf("decodeTOTPSecret(%q) succeeded, want an error", seed)
+		}
+	}
+}
+
+func TestNextTOTPStep(t *testing.T) {
+	serial, other := "arn:aws:iam::123456789012:mfa/test", "arn:aws:iam::123456789012:mfa/other"
+	defer func() {
+		totpLastStep.Lock()
+		delete(totpLastStep.steps, serial)
+		delete(totpLastStep.steps, other)
+		totpLastStep.Unlock()
+	}()
+
+	if step := nextTOTPStep(serial, 100); step != 100 {
+		t.Errorf("first step = %v, want 100", step)
+	}
+	if step := nextTOTPStep(serial, 100); step != 101 {
+		t.Errorf("step after a used code = %v, want 101", step)
+	}
+	if step := nextTOTPStep(serial, 100); step != 102 {
+		t.Errorf("step after two used codes = %v, want 102", step)
+	}
+	if step := nextTOTPStep(other, 100); step != 100 {
+		t.Errorf("step of another serial = %v, want 100", step)
+	}
+}